@@ -0,0 +1,265 @@
+package grlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An OverflowPolicy decides what an async file does with a record when
+// its queue is full, see FileOptions.Overflow.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Write wait for room in the queue, the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the record being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued record to make room.
+	OverflowDropOldest
+	// OverflowDropBelow drops the records less severe than
+	// FileOptions.OverflowLevel: the record being written if it is one,
+	// otherwise the oldest queued one. If there is none Write waits.
+	OverflowDropBelow
+)
+
+// maxPooledBuffer is the capacity above which the buffer of a queued
+// record is not reused, so that one large record does not pin memory.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds the buffers of queued records.
+var bufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// asyncRecord is a queued write.
+type asyncRecord struct {
+	level int
+	data  *[]byte // from bufferPool
+}
+
+// asyncWriter queues the writes of a rotating file and writes them in
+// order from a separate goroutine. Queued records are copies, so callers
+// may reuse their buffers, as Logger does.
+type asyncWriter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond // signalled when the queue changes or on close
+	queue     []asyncRecord
+	spare     []asyncRecord // the previous queue, reused
+	size      int
+	policy    OverflowPolicy
+	level     int           // see OverflowDropBelow
+	timeout   time.Duration // of close, 0 for none
+	closed    bool
+	err       error  // of an earlier write, returned by the next call
+	queued    uint64 // number of records queued so far
+	completed uint64 // number of queued records written or dropped
+	dropped   uint64
+	write     func(level int, p []byte) (int, error)
+	stop      atomic.Bool   // set on a close timeout, see close
+	done      chan struct{} // closed when the goroutine exits
+}
+
+// newAsyncWriter starts writing the queued records with write, using
+// the async options of opts.
+func newAsyncWriter(opts FileOptions, write func(level int, p []byte) (int, error)) *asyncWriter {
+	a := &asyncWriter{
+		queue:   make([]asyncRecord, 0, opts.BufferSize),
+		spare:   make([]asyncRecord, 0, opts.BufferSize),
+		size:    opts.BufferSize,
+		policy:  opts.Overflow,
+		level:   opts.OverflowLevel,
+		timeout: opts.CloseTimeout,
+		write:   write,
+		done:    make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// enqueue queues a copy of p, written at level, applying the overflow
+// policy if the queue is full. It returns the error of an earlier write,
+// if any.
+func (a *asyncWriter) enqueue(level int, p []byte) (n int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.queue) >= a.size {
+		if a.closed {
+			return 0, os.ErrClosed
+		}
+		switch a.policy {
+		case OverflowDropNewest:
+			a.dropped++
+			return len(p), a.takeErr()
+		case OverflowDropOldest:
+			a.dropAt(0)
+			continue
+		case OverflowDropBelow:
+			if level > a.level {
+				a.dropped++
+				return len(p), a.takeErr()
+			}
+			if i := a.indexBelow(); i >= 0 {
+				a.dropAt(i)
+				continue
+			}
+		}
+		a.cond.Wait()
+	}
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+	buf := bufferPool.Get().(*[]byte)
+	*buf = append((*buf)[:0], p...)
+	a.queue = append(a.queue, asyncRecord{level: level, data: buf})
+	a.queued++
+	a.cond.Broadcast()
+	return len(p), a.takeErr()
+}
+
+// takeErr returns and clears the error of an earlier write. a.mu must
+// be held.
+func (a *asyncWriter) takeErr() error {
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// indexBelow returns the index of the oldest queued record less severe
+// than a.level, or -1. a.mu must be held.
+func (a *asyncWriter) indexBelow() int {
+	for i, r := range a.queue {
+		if r.level > a.level {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropAt removes the queued record at i. a.mu must be held.
+func (a *asyncWriter) dropAt(i int) {
+	putBuffer(a.queue[i].data)
+	n := copy(a.queue[i:], a.queue[i+1:])
+	a.queue[i+n] = asyncRecord{}
+	a.queue = a.queue[:i+n]
+	a.dropped++
+	a.completed++
+	a.cond.Broadcast()
+}
+
+// droppedCount returns the number of records dropped by the overflow
+// policy or on a close timeout.
+func (a *asyncWriter) droppedCount() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	a.mu.Lock()
+	for {
+		for len(a.queue) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		if len(a.queue) == 0 {
+			a.mu.Unlock()
+			return
+		}
+		batch := a.queue
+		a.queue = a.spare
+		a.cond.Broadcast()
+		a.mu.Unlock()
+		var err error
+		var skipped uint64
+		for i, r := range batch {
+			if a.stop.Load() {
+				skipped++
+			} else if _, werr := a.write(r.level, *r.data); werr != nil {
+				err = werr
+			}
+			putBuffer(r.data)
+			batch[i] = asyncRecord{}
+		}
+		a.mu.Lock()
+		if err != nil {
+			a.err = err
+		}
+		a.dropped += skipped
+		a.completed += uint64(len(batch))
+		a.spare = batch[:0]
+		a.cond.Broadcast()
+	}
+}
+
+// flush waits until the records queued before the call are written, or
+// ctx is done. It returns the error of an earlier write, if any.
+func (a *asyncWriter) flush(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.cond.Broadcast()
+			a.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	target := a.queued
+	for a.completed < target {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a.cond.Wait()
+	}
+	return a.takeErr()
+}
+
+// close writes the queued records and stops the goroutine. If that
+// takes longer than a.timeout the goroutine stops after the record it is
+// writing, and the records not written are dropped. Either way no record
+// is written once close returns. It returns the last write error not
+// returned yet, or the timeout. Later writes fail with os.ErrClosed.
+func (a *asyncWriter) close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.cond.Broadcast()
+	a.mu.Unlock()
+	if a.timeout <= 0 {
+		<-a.done
+	} else {
+		timer := time.NewTimer(a.timeout)
+		defer timer.Stop()
+		select {
+		case <-a.done:
+		case <-timer.C:
+			a.mu.Lock()
+			a.stop.Store(true)
+			dropped := a.dropped
+			for len(a.queue) > 0 {
+				a.dropAt(len(a.queue) - 1)
+			}
+			a.mu.Unlock()
+			<-a.done
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return fmt.Errorf("grlog: close timed out, %d queued records dropped", a.dropped-dropped)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.takeErr()
+}
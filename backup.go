@@ -0,0 +1,193 @@
+package grlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const compressSuffix = ".gz"
+
+// compressFile gzips name into name.gz and removes name. The compressed
+// file keeps the mode and modification time of name. It is written under
+// a temporary name first, so name.gz never holds partial data.
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := name + compressSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name+compressSuffix); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// exists reports whether a file named name exists.
+func exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// A backup is a rotated log file, possibly compressed.
+type backup struct {
+	path    string // the path without compressSuffix
+	modTime time.Time
+	size    int64 // the total size of the plain and compressed files
+}
+
+// listBackups returns the backups in dir whose names match pattern,
+// oldest first. A backup being compressed, present both plain and
+// compressed, is listed once.
+func listBackups(dir string, pattern *regexp.Regexp) []backup {
+	entries, _ := os.ReadDir(dir)
+	backups := make([]backup, 0, len(entries))
+	index := make(map[string]int, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !pattern.MatchString(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := path.Join(dir, strings.TrimSuffix(e.Name(), compressSuffix))
+		if i, ok := index[name]; ok {
+			backups[i].size += fi.Size()
+			if fi.ModTime().After(backups[i].modTime) {
+				backups[i].modTime = fi.ModTime()
+			}
+			continue
+		}
+		index[name] = len(backups)
+		backups = append(backups, backup{path: name, modTime: fi.ModTime(), size: fi.Size()})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].modTime.Before(backups[j].modTime)
+		}
+		return backups[i].path < backups[j].path
+	})
+	return backups
+}
+
+// remove deletes the plain and compressed files of b, reporting each
+// removed file and each failure to h.
+func (b backup) remove(h *hooks) {
+	removeFile(b.path, h)
+	removeFile(b.path+compressSuffix, h)
+}
+
+// removeFile deletes name if it exists, reporting the removal or the
+// failure to h.
+func removeFile(name string, h *hooks) {
+	if err := os.Remove(name); err == nil {
+		h.pruned(name)
+	} else if !os.IsNotExist(err) {
+		h.failed(err)
+	}
+}
+
+// removeExpired deletes the backups last modified more than maxAge ago
+// and returns the rest. It does nothing if maxAge <= 0.
+func removeExpired(backups []backup, maxAge time.Duration, h *hooks) []backup {
+	if maxAge <= 0 {
+		return backups
+	}
+	cutoff := time.Now().Add(-maxAge)
+	i := 0
+	for i < len(backups) && backups[i].modTime.Before(cutoff) {
+		backups[i].remove(h)
+		i++
+	}
+	return backups[i:]
+}
+
+// pruneInterval returns how often backups are checked for expiry when
+// the log file is idle.
+func pruneInterval(maxAge time.Duration) time.Duration {
+	if maxAge < time.Hour {
+		return maxAge
+	}
+	return time.Hour
+}
+
+// removeOverBudget deletes the oldest backups until their total size plus
+// active, the size of the active file, is at most maxTotal, and returns
+// the rest. It does nothing if maxTotal <= 0.
+func removeOverBudget(backups []backup, active int64, maxTotal int64, h *hooks) []backup {
+	if maxTotal <= 0 {
+		return backups
+	}
+	total := active
+	for _, b := range backups {
+		total += b.size
+	}
+	i := 0
+	for i < len(backups) && total > maxTotal {
+		backups[i].remove(h)
+		total -= backups[i].size
+		i++
+	}
+	return backups[i:]
+}
+
+// finishBackup reports the rotation of the file now at name to h, after
+// compressing it in the background if compress is set. active is the
+// path of the new file. wg tracks the background compression.
+func finishBackup(name string, active string, compress bool, wg *sync.WaitGroup, h *hooks) {
+	if !compress {
+		h.rotated(name, active)
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := compressFile(name); err != nil {
+			h.failed(err)
+			h.rotated(name, active)
+			return
+		}
+		h.rotated(name+compressSuffix, active)
+	}()
+}
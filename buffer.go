@@ -0,0 +1,86 @@
+package grlog
+
+import (
+	"os"
+	"time"
+)
+
+const defaultFlushInterval = time.Second
+
+// writeBuffer coalesces the records of a rotating file into large
+// writes. It is flushed when full, when an error record is written and
+// after an interval. It is guarded by the mutex of the file; a nil
+// writeBuffer writes through.
+type writeBuffer struct {
+	buf      []byte
+	size     int
+	interval time.Duration
+	timer    *time.Timer // flushes after interval, see newWriteBuffer
+	armed    bool        // whether timer is running
+}
+
+// newWriteBuffer returns a buffer of size bytes. The timer calls flush,
+// which must lock the file and call writeBuffer.flush.
+func newWriteBuffer(size int, interval time.Duration, flush func()) *writeBuffer {
+	b := &writeBuffer{buf: make([]byte, 0, size), size: size, interval: interval}
+	b.timer = time.AfterFunc(interval, flush)
+	b.timer.Stop()
+	return b
+}
+
+// buffered returns the number of bytes not written to the file yet.
+func (b *writeBuffer) buffered() int64 {
+	if b == nil {
+		return 0
+	}
+	return int64(len(b.buf))
+}
+
+// write buffers p, a record at level, for file.
+func (b *writeBuffer) write(file *os.File, level int, p []byte) (int, error) {
+	if b == nil {
+		return file.Write(p)
+	}
+	if len(b.buf)+len(p) > b.size {
+		if err := b.flush(file); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > b.size { // too large to buffer
+		return file.Write(p)
+	}
+	b.buf = append(b.buf, p...)
+	if level <= LevelError {
+		return len(p), b.flush(file)
+	}
+	if !b.armed {
+		b.armed = true
+		b.timer.Reset(b.interval)
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered records to file. On error the unwritten
+// bytes are kept for the next flush.
+func (b *writeBuffer) flush(file *os.File) error {
+	if b == nil {
+		return nil
+	}
+	if b.armed {
+		b.armed = false
+		b.timer.Stop()
+	}
+	if len(b.buf) == 0 {
+		return nil
+	}
+	n, err := file.Write(b.buf)
+	b.buf = b.buf[:copy(b.buf, b.buf[n:])]
+	return err
+}
+
+// stop stops the timer.
+func (b *writeBuffer) stop() {
+	if b != nil {
+		b.timer.Stop()
+	}
+}
@@ -0,0 +1,79 @@
+package grlog
+
+import (
+	"io"
+	"os"
+)
+
+// ANSI escape sequences used to color the level.
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorGray   = "\x1b[90m"
+)
+
+// ConsoleFormatter is a Formatter for humans reading a terminal. It lays
+// out records like TextFormatter, optionally coloring the level (ERROR
+// red, WARN yellow, INFO green, DEBUG gray) and padding it to a fixed
+// width so that the messages line up.
+type ConsoleFormatter struct {
+	Color bool // color the level with ANSI escape sequences
+	Align bool // pad the level to the width of the longest level name
+}
+
+// NewConsoleFormatter returns a ConsoleFormatter for output to w. Colors
+// are enabled only if w is a terminal and the NO_COLOR environment
+// variable is empty; columns are always aligned.
+//
+//	log.SetFormatter(grlog.NewConsoleFormatter(os.Stderr))
+func NewConsoleFormatter(w io.Writer) *ConsoleFormatter {
+	return &ConsoleFormatter{
+		Color: os.Getenv("NO_COLOR") == "" && isTerminal(w),
+		Align: true,
+	}
+}
+
+// Format implements Formatter.
+func (c *ConsoleFormatter) Format(buf *[]byte, r *Record) {
+	formatText(buf, r, c)
+}
+
+func (c *ConsoleFormatter) appendLevel(buf *[]byte, level int) {
+	name := levelName(level)
+	if c.Color {
+		switch {
+		case level <= LevelError:
+			*buf = append(*buf, colorRed...)
+		case level <= LevelWarn:
+			*buf = append(*buf, colorYellow...)
+		case level <= LevelInfo:
+			*buf = append(*buf, colorGreen...)
+		default:
+			*buf = append(*buf, colorGray...)
+		}
+		*buf = append(*buf, name...)
+		*buf = append(*buf, colorReset...)
+	} else {
+		*buf = append(*buf, name...)
+	}
+	if c.Align {
+		for i := len(name); i < len("ERROR"); i++ {
+			*buf = append(*buf, ' ')
+		}
+	}
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
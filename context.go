@@ -0,0 +1,124 @@
+package grlog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// A ContextExtractor returns the fields to attach to records logged with
+// ctx, such as a trace ID or request ID. It returns nil when ctx carries
+// nothing of interest.
+type ContextExtractor func(ctx context.Context) []Field
+
+var extractors struct {
+	mu  sync.RWMutex
+	fns []*ContextExtractor // pointers, so that they can be removed
+}
+
+// RegisterContextExtractor adds fn to the extractors consulted by the Ctx
+// logging methods. Extractors run in the order they were registered and
+// should be registered during program initialization. The returned
+// function removes fn again; calling it more than once does nothing.
+func RegisterContextExtractor(fn ContextExtractor) (remove func()) {
+	p := &fn
+	extractors.mu.Lock()
+	defer extractors.mu.Unlock()
+	extractors.fns = append(extractors.fns, p)
+	return func() {
+		extractors.mu.Lock()
+		defer extractors.mu.Unlock()
+		for i, q := range extractors.fns {
+			if q == p {
+				extractors.fns = append(extractors.fns[:i], extractors.fns[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// ContextValue returns a ContextExtractor that adds ctx.Value(key) under
+// the field name name, when the value is not nil:
+//
+//	grlog.RegisterContextExtractor(grlog.ContextValue("request_id", requestIDKey{}))
+func ContextValue(name string, key any) ContextExtractor {
+	return func(ctx context.Context) []Field {
+		if v := ctx.Value(key); v != nil {
+			return []Field{{Key: name, Value: v}}
+		}
+		return nil
+	}
+}
+
+// contextFields returns the fields of all registered extractors for ctx.
+func contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	var fields []Field
+	for _, fn := range extractors.fns {
+		fields = append(fields, (*fn)(ctx)...)
+	}
+	return fields
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx that carries l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger
+// if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*Logger); ok && l != nil {
+			return l
+		}
+	}
+	return std
+}
+
+// ErrorCtx is like Error, and adds the fields extracted from ctx.
+func (l *Logger) ErrorCtx(ctx context.Context, format string, v ...any) {
+	if !l.enabled(LevelError) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelError)
+}
+
+// WarnCtx is like Warn, and adds the fields extracted from ctx.
+func (l *Logger) WarnCtx(ctx context.Context, format string, v ...any) {
+	if !l.enabled(LevelWarn) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelWarn)
+}
+
+// InfoCtx is like Info, and adds the fields extracted from ctx.
+func (l *Logger) InfoCtx(ctx context.Context, format string, v ...any) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelInfo)
+}
+
+// DebugCtx is like Debug, and adds the fields extracted from ctx.
+func (l *Logger) DebugCtx(ctx context.Context, format string, v ...any) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelDebug)
+}
+
+// LogCtx is like Log, and adds the fields extracted from ctx.
+func (l *Logger) LogCtx(ctx context.Context, level int, format string, v ...any) {
+	if atomic.LoadInt32(&l.isDiscard) != 0 {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), level)
+}
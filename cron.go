@@ -0,0 +1,213 @@
+package grlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCron returns a schedule for a standard 5-field cron expression,
+// "minute hour day-of-month month day-of-week", evaluated in loc, or in
+// the local time zone if loc is nil. Each field is "*" or a list of
+// values, ranges "a-b" and steps "*/n" or "a-b/n"; months and weekdays
+// may be given by their three-letter English names, and Sunday is 0 or
+// 7. As in cron, when both day fields are restricted a day matching
+// either one is selected. Several expressions may be joined with ";":
+//
+//	grlog.ParseCron("30 2 * * *; 0 0 * * sun", nil) // 02:30 daily, and Sunday 00:00
+//
+// Across daylight saving time transitions, wall clock times that are
+// skipped do not trigger a rotation, and times that repeat trigger it
+// only once.
+func ParseCron(spec string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	s := cronSchedule{loc: loc}
+	for _, expr := range strings.Split(spec, ";") {
+		c, err := parseCronExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		s.exprs = append(s.exprs, c)
+	}
+	return s, nil
+}
+
+type cronSchedule struct {
+	exprs []cronExpr
+	loc   *time.Location
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, c := range s.exprs {
+		if n := c.next(t.In(s.loc)); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	if next.IsZero() { // never: rotate by size only
+		return time.Date(9999, 12, 31, 0, 0, 0, 0, t.Location())
+	}
+	return next.In(t.Location())
+}
+
+func (s cronSchedule) Layout() string { return "2006-01-02T1504" }
+
+// A cronExpr holds the allowed values of each field as bit sets.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type cronField struct {
+	min, max int
+	names    []string // names of the values from min
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDow    = cronField{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+func parseCronExpr(expr string) (c cronExpr, err error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("grlog: cron expression %q: expected 5 fields, found %d", expr, len(fields))
+	}
+	if c.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return c, fmt.Errorf("grlog: cron expression %q: minute: %v", expr, err)
+	}
+	if c.hour, err = cronHour.parse(fields[1]); err != nil {
+		return c, fmt.Errorf("grlog: cron expression %q: hour: %v", expr, err)
+	}
+	if c.dom, err = cronDom.parse(fields[2]); err != nil {
+		return c, fmt.Errorf("grlog: cron expression %q: day of month: %v", expr, err)
+	}
+	if c.month, err = cronMonth.parse(fields[3]); err != nil {
+		return c, fmt.Errorf("grlog: cron expression %q: month: %v", expr, err)
+	}
+	if c.dow, err = cronDow.parse(fields[4]); err != nil {
+		return c, fmt.Errorf("grlog: cron expression %q: day of week: %v", expr, err)
+	}
+	if c.dow&(1<<7) != 0 { // 7 is Sunday too
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parse returns the bit set of the values in a comma-separated list.
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			rng, step = part[:i], n
+		}
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				if lo, err = f.value(rng[:i]); err != nil {
+					return 0, err
+				}
+				if hi, err = f.value(rng[i+1:]); err != nil {
+					return 0, err
+				}
+			} else {
+				if lo, err = f.value(rng); err != nil {
+					return 0, err
+				}
+				hi = lo
+				if step > 1 { // "a/n" means from a to the maximum
+					hi = f.max
+				}
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func (c cronExpr) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t matching c, or the zero time if
+// there is none within five years.
+func (c cronExpr) next(t time.Time) time.Time {
+	loc := t.Location()
+	// start at the next whole minute
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 || isRepeated(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// isRepeated reports whether the wall clock time of t already occurred
+// earlier, because the clocks were set back in between.
+func isRepeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	if _, off := earlier.Zone(); off == offset {
+		return false
+	}
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := earlier.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2 && t.Hour() == earlier.Hour() && t.Minute() == earlier.Minute()
+}
@@ -0,0 +1,90 @@
+package grlog
+
+import "time"
+
+// A SyncPolicy decides when a rotating file calls fsync, trading
+// throughput for the records that survive a crash of the machine, see
+// FileOptions.SyncPolicy.
+type SyncPolicy int
+
+const (
+	// SyncNever leaves writing to disk to the operating system, the
+	// default. A file is still synced before it is rotated.
+	SyncNever SyncPolicy = iota
+	// SyncEveryN syncs after every FileOptions.SyncEvery records.
+	SyncEveryN
+	// SyncPeriodic syncs at most FileOptions.SyncInterval after a record
+	// is written.
+	SyncPeriodic
+	// SyncAlways syncs after each record, before Write returns.
+	SyncAlways
+)
+
+const (
+	defaultSyncEvery    = 100
+	defaultSyncInterval = time.Second
+)
+
+// syncer applies a SyncPolicy. It is guarded by the mutex of the file;
+// a nil syncer never syncs.
+type syncer struct {
+	policy   SyncPolicy
+	every    int
+	interval time.Duration
+	pending  int         // records written since the last sync
+	timer    *time.Timer // syncs after interval, see newSyncer
+	armed    bool        // whether timer is running
+}
+
+// newSyncer returns the syncer of the policy of opts, or nil for
+// SyncNever. The timer of SyncPeriodic calls sync, which must lock the
+// file and sync it.
+func newSyncer(opts FileOptions, sync func()) *syncer {
+	if opts.SyncPolicy == SyncNever {
+		return nil
+	}
+	s := &syncer{policy: opts.SyncPolicy, every: opts.SyncEvery, interval: opts.SyncInterval}
+	if s.policy == SyncPeriodic {
+		s.timer = time.AfterFunc(s.interval, sync)
+		s.timer.Stop()
+	}
+	return s
+}
+
+// wrote records that a record was written and reports whether the file
+// must be synced now.
+func (s *syncer) wrote() bool {
+	if s == nil {
+		return false
+	}
+	s.pending++
+	switch s.policy {
+	case SyncEveryN:
+		return s.pending >= s.every
+	case SyncPeriodic:
+		if !s.armed {
+			s.armed = true
+			s.timer.Reset(s.interval)
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// synced records that the file was synced.
+func (s *syncer) synced() {
+	if s == nil {
+		return
+	}
+	s.pending = 0
+	if s.armed {
+		s.armed = false
+		s.timer.Stop()
+	}
+}
+
+// dirty reports whether records were written since the last sync.
+func (s *syncer) dirty() bool {
+	return s != nil && s.pending > 0
+}
@@ -0,0 +1,180 @@
+package grlog
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// badKey is the key used for a value that has no key in a key/value list.
+const badKey = "!BADKEY"
+
+// A Field is a key/value pair attached to a log record.
+// Fields are rendered after the message as key=value.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Any returns a Field for an arbitrary value.
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// String returns a Field for a string value.
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns a Field for an int value.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int64 returns a Field for an int64 value.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Float64 returns a Field for a float64 value.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Bool returns a Field for a bool value.
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration returns a Field for a time.Duration value.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Time returns a Field for a time.Time value.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns a Field with the key "error".
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// fieldsOf converts a list of alternating keys and values into fields.
+// Field values in the list are used as they are. A value without a
+// string key is given the key "!BADKEY".
+func fieldsOf(kv []any) []Field {
+	if len(kv) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i++ {
+		switch k := kv[i].(type) {
+		case Field:
+			fields = append(fields, k)
+		case string:
+			if i+1 < len(kv) {
+				fields = append(fields, Field{Key: k, Value: kv[i+1]})
+				i++
+			} else {
+				fields = append(fields, Field{Key: badKey, Value: k})
+			}
+		default:
+			fields = append(fields, Field{Key: badKey, Value: k})
+		}
+	}
+	return fields
+}
+
+// appendFields writes fields to buf as " key=value" pairs. Keys are
+// cleaned like logfmt keys, so the pairs stay parseable.
+func appendFields(buf *[]byte, fields []Field) {
+	for _, f := range fields {
+		*buf = append(*buf, ' ')
+		appendLogfmtKey(buf, f.Key)
+		*buf = append(*buf, '=')
+		appendValue(buf, f.Value)
+	}
+}
+
+// appendValue writes the text form of v to buf, quoting it when it is
+// empty or contains spaces, quotes, '=' or non-printable characters.
+func appendValue(buf *[]byte, v any) {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		s = "<nil>"
+	case string:
+		s = v
+	case int:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+		return
+	case int64:
+		*buf = strconv.AppendInt(*buf, v, 10)
+		return
+	case uint64:
+		*buf = strconv.AppendUint(*buf, v, 10)
+		return
+	case float64:
+		*buf = strconv.AppendFloat(*buf, v, 'g', -1, 64)
+		return
+	case bool:
+		*buf = strconv.AppendBool(*buf, v)
+		return
+	case time.Duration:
+		s = v.String()
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case error:
+		if isNilPointer(v) {
+			s = "<nil>"
+		} else {
+			s = v.Error()
+		}
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			s = "<nil>"
+		} else {
+			s = v.String()
+		}
+	default:
+		s = fmt.Sprint(v)
+	}
+	if needsQuote(s) {
+		*buf = strconv.AppendQuote(*buf, s)
+	} else {
+		*buf = append(*buf, s...)
+	}
+}
+
+// isNilPointer reports whether v is a nil pointer, on which calling
+// Error or String would usually panic.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+func needsQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || !strconv.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
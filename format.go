@@ -0,0 +1,135 @@
+package grlog
+
+import "time"
+
+// A Record holds everything known about a single logging event.
+type Record struct {
+	Time     time.Time // when the event happened
+	Level    int       // the level of the event, valid if HasLevel is set
+	HasLevel bool      // false for Print, Fatal and Panic records
+	Name     string    // the logger's dotted name, see Logger.Named
+	Prefix   string    // the logger's prefix
+	File     string    // the caller's file, set only with FlagSFile or FlagLFile
+	Line     int       // the caller's line, set only with FlagSFile or FlagLFile
+	Message  string    // the formatted message
+	Fields   []Field   // structured fields, in the order they were given
+	Flag     int       // the logger's flags
+
+	// TimeLayout is the logger's time layout, see Logger.SetTimeLayout.
+	// Empty for the default layout of the formatter.
+	TimeLayout string
+}
+
+// A Formatter lays out a Record. Format appends the complete record,
+// including the trailing newline, to buf. A Logger serializes calls to
+// its Formatter.
+type Formatter interface {
+	Format(buf *[]byte, r *Record)
+}
+
+// TextFormatter is the default Formatter. It writes the header selected
+// by the record's flags, then the message and the fields as key=value.
+type TextFormatter struct{}
+
+// Format implements Formatter.
+func (TextFormatter) Format(buf *[]byte, r *Record) {
+	formatText(buf, r, nil)
+}
+
+// formatText writes r as a text line. The level is written by c when it
+// is not nil.
+func formatText(buf *[]byte, r *Record, c *ConsoleFormatter) {
+	formatHeader(buf, r, c)
+	s := r.Message
+	*buf = append(*buf, s...)
+	if len(r.Fields) > 0 {
+		if len(s) > 0 && s[len(s)-1] == '\n' {
+			*buf = (*buf)[:len(*buf)-1]
+		}
+		appendFields(buf, r.Fields)
+		*buf = append(*buf, '\n')
+	} else if len(s) == 0 || s[len(s)-1] != '\n' {
+		*buf = append(*buf, '\n')
+	}
+}
+
+// formatHeader writes log header to buf in following order:
+//   - r.Prefix (if it's not blank and FlagPrefix is unset),
+//   - the time in r.TimeLayout (if set), otherwise
+//     date and/or time (if corresponding flags are provided),
+//   - file and line number (if corresponding flags are provided),
+//   - level (if FlagLevel is set and the record has one),
+//   - [name] (if the logger has a name),
+//   - r.Prefix (if it's not blank and FlagPrefix is set).
+func formatHeader(buf *[]byte, r *Record, c *ConsoleFormatter) {
+	flag, t := r.Flag, r.Time
+	if flag&FlagPrefix == 0 {
+		*buf = append(*buf, r.Prefix...)
+	}
+	if r.TimeLayout != "" {
+		if flag&FlagUTC != 0 {
+			t = t.UTC()
+		}
+		appendTime(buf, t, r.TimeLayout)
+		*buf = append(*buf, ' ')
+	} else if flag&(FlagDate|FlagTime|FlagMtime) != 0 {
+		if flag&FlagUTC != 0 {
+			t = t.UTC()
+		}
+		if flag&FlagDate != 0 {
+			year, month, day := t.Date()
+			itoa(buf, year, 4)
+			*buf = append(*buf, '/')
+			itoa(buf, int(month), 2)
+			*buf = append(*buf, '/')
+			itoa(buf, day, 2)
+			*buf = append(*buf, ' ')
+		}
+		if flag&(FlagTime|FlagMtime) != 0 {
+			hour, min, sec := t.Clock()
+			itoa(buf, hour, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, min, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, sec, 2)
+			if flag&FlagMtime != 0 {
+				*buf = append(*buf, '.')
+				itoa(buf, t.Nanosecond()/1e3, 6)
+			}
+			*buf = append(*buf, ' ')
+		}
+	}
+	if flag&(FlagSFile|FlagLFile) != 0 {
+		file := r.File
+		if flag&FlagSFile != 0 {
+			short := file
+			for i := len(file) - 1; i > 0; i-- {
+				if file[i] == '/' {
+					short = file[i+1:]
+					break
+				}
+			}
+			file = short
+		}
+		*buf = append(*buf, file...)
+		*buf = append(*buf, ':')
+		itoa(buf, r.Line, -1)
+		*buf = append(*buf, ' ')
+	}
+	if flag&FlagLevel != 0 && r.HasLevel {
+		if c != nil {
+			c.appendLevel(buf, r.Level)
+		} else {
+			*buf = append(*buf, levelName(r.Level)...)
+		}
+		*buf = append(*buf, ' ')
+	}
+	if r.Name != "" {
+		*buf = append(*buf, '[')
+		*buf = append(*buf, r.Name...)
+		*buf = append(*buf, "] "...)
+	}
+	if flag&FlagPrefix != 0 {
+		*buf = append(*buf, r.Prefix...)
+	}
+}
@@ -0,0 +1,66 @@
+package grlog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// A HeaderFunc writes the header of a new log file to w, so that each
+// file describes itself when read in isolation. It is called with the
+// rotating file locked and must not log to it.
+type HeaderFunc func(w io.Writer) error
+
+// processStart is the start time reported by StandardHeader.
+var processStart = time.Now()
+
+// StandardHeader returns a HeaderFunc writing a comment line with the
+// host name, process id, build version, process start time and schema,
+// the format of the records that follow:
+//
+//	# host=web1 pid=4242 version=v1.2.3 start=2024-01-01T13:00:00Z schema=json
+//
+// An empty version is replaced by the main module version from the
+// build info.
+func StandardHeader(version string, schema string) HeaderFunc {
+	host, _ := os.Hostname()
+	if version == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			version = info.Main.Version
+		}
+	}
+	return func(w io.Writer) error {
+		buf := []byte{'#'}
+		appendFields(&buf, []Field{
+			String("host", host),
+			Int("pid", os.Getpid()),
+			String("version", version),
+			Time("start", processStart),
+			String("schema", schema),
+		})
+		buf = append(buf, '\n')
+		_, err := w.Write(buf)
+		return err
+	}
+}
+
+// writeHeader writes the header of fn to file if file is empty, and
+// returns the size of file afterwards. The header is written with a
+// single write, so it is not interleaved with records.
+func writeHeader(file *os.File, fn HeaderFunc) (int64, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fn == nil || fi.Size() > 0 {
+		return fi.Size(), nil
+	}
+	var buf bytes.Buffer
+	if err := fn(&buf); err != nil {
+		return 0, err
+	}
+	n, err := file.Write(buf.Bytes())
+	return int64(n), err
+}
@@ -0,0 +1,159 @@
+package grlog
+
+import "sync"
+
+// hooks runs the lifecycle callbacks of a rotating file. Events are
+// queued and the callbacks are called one at a time from a separate
+// goroutine, so they never run under the file's lock and a slow callback
+// does not delay writes.
+type hooks struct {
+	mu       sync.Mutex
+	onRotate func(oldPath, newPath string)
+	onPrune  func(path string)
+	onError  func(err error)
+	queue    serialQueue
+	rotating int // queued rotate callbacks, see waitRotated
+	closed   bool
+	idle     *sync.Cond // signalled when rotate callbacks have run
+}
+
+func (h *hooks) setRotate(fn func(oldPath, newPath string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onRotate = fn
+}
+
+func (h *hooks) setPrune(fn func(path string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onPrune = fn
+}
+
+func (h *hooks) setError(fn func(err error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onError = fn
+}
+
+func (h *hooks) rotated(oldPath, newPath string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fn := h.onRotate; fn != nil && !h.closed {
+		h.rotating++
+		h.postLocked(func() {
+			fn(oldPath, newPath)
+			h.mu.Lock()
+			h.rotating--
+			h.idleLocked().Broadcast()
+			h.mu.Unlock()
+		})
+	}
+}
+
+// waitRotated waits until the queued rotate callbacks have run, so that
+// the backups they were given can be renamed or removed.
+func (h *hooks) waitRotated() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for h.rotating > 0 {
+		h.idleLocked().Wait()
+	}
+}
+
+// idleLocked returns the condition signalled when rotate callbacks have
+// run. h.mu must be held.
+func (h *hooks) idleLocked() *sync.Cond {
+	if h.idle == nil {
+		h.idle = sync.NewCond(&h.mu)
+	}
+	return h.idle
+}
+
+func (h *hooks) pruned(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fn := h.onPrune; fn != nil {
+		h.postLocked(func() { fn(path) })
+	}
+}
+
+func (h *hooks) failed(err error) {
+	if err == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fn := h.onError; fn != nil {
+		h.postLocked(func() { fn(err) })
+	}
+}
+
+// postLocked queues fn, unless h is closed. h.mu must be held.
+func (h *hooks) postLocked(fn func()) {
+	if !h.closed {
+		h.queue.post(fn)
+	}
+}
+
+// close waits until the queued callbacks have run; later events are
+// dropped.
+func (h *hooks) close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.queue.wait()
+}
+
+// serialQueue runs functions one at a time and in order, from a
+// goroutine started when needed.
+type serialQueue struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool
+	idle    *sync.Cond // signalled when the queue is drained
+}
+
+// post queues fn, starting the goroutine that runs the queue if needed.
+func (q *serialQueue) post(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queue = append(q.queue, fn)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+func (q *serialQueue) run() {
+	q.mu.Lock()
+	for len(q.queue) > 0 {
+		fn := q.queue[0]
+		q.queue[0] = nil
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+		fn()
+		q.mu.Lock()
+	}
+	q.running = false
+	q.idleLocked().Broadcast()
+	q.mu.Unlock()
+}
+
+// wait waits until the queued functions have run, including those they
+// queue.
+func (q *serialQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.running {
+		q.idleLocked().Wait()
+	}
+}
+
+// idleLocked returns the condition signalled when the queue is drained.
+// q.mu must be held.
+func (q *serialQueue) idleLocked() *sync.Cond {
+	if q.idle == nil {
+		q.idle = sync.NewCond(&q.mu)
+	}
+	return q.idle
+}
@@ -0,0 +1,178 @@
+package grlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONFormatter is a Formatter that writes each record as a single JSON object:
+//
+//	{"time":"...","level":"info","logger":"api.auth","prefix":"...","caller":"d.go:23","msg":"...","key":"value"}
+//
+// logger and prefix are omitted when blank, level when the record has
+// none and caller unless FlagSFile or FlagLFile is set.
+type JSONFormatter struct{}
+
+// Format implements Formatter.
+func (JSONFormatter) Format(buf *[]byte, r *Record) {
+	t := r.Time
+	if r.Flag&FlagUTC != 0 {
+		t = t.UTC()
+	}
+	*buf = append(*buf, `{"time":`...)
+	switch {
+	case r.TimeLayout == "":
+		*buf = append(*buf, '"')
+		*buf = t.AppendFormat(*buf, time.RFC3339Nano)
+		*buf = append(*buf, '"')
+	case isUnixLayout(r.TimeLayout):
+		appendTime(buf, t, r.TimeLayout)
+	default:
+		appendJSONString(buf, t.Format(r.TimeLayout))
+	}
+	if r.HasLevel {
+		*buf = append(*buf, `,"level":"`...)
+		*buf = append(*buf, levelKey(r.Level)...)
+		*buf = append(*buf, '"')
+	}
+	if r.Name != "" {
+		*buf = append(*buf, `,"logger":`...)
+		appendJSONString(buf, r.Name)
+	}
+	if r.Prefix != "" {
+		*buf = append(*buf, `,"prefix":`...)
+		appendJSONString(buf, r.Prefix)
+	}
+	if r.Flag&(FlagSFile|FlagLFile) != 0 {
+		*buf = append(*buf, `,"caller":`...)
+		appendJSONString(buf, caller(r.File, r.Line, r.Flag))
+	}
+	msg := r.Message
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	*buf = append(*buf, `,"msg":`...)
+	appendJSONString(buf, msg)
+	for _, f := range r.Fields {
+		*buf = append(*buf, ',')
+		appendJSONString(buf, f.Key)
+		*buf = append(*buf, ':')
+		appendJSONValue(buf, f.Value)
+	}
+	*buf = append(*buf, '}', '\n')
+}
+
+// caller returns "file:line", shortening file when FlagSFile is set.
+func caller(file string, line int, flag int) string {
+	if flag&FlagSFile != 0 {
+		for i := len(file) - 1; i > 0; i-- {
+			if file[i] == '/' {
+				file = file[i+1:]
+				break
+			}
+		}
+	}
+	return file + ":" + strconv.Itoa(line)
+}
+
+func appendJSONValue(buf *[]byte, v any) {
+	switch v := v.(type) {
+	case nil:
+		*buf = append(*buf, "null"...)
+	case string:
+		appendJSONString(buf, v)
+	case int:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+	case int64:
+		*buf = strconv.AppendInt(*buf, v, 10)
+	case uint64:
+		*buf = strconv.AppendUint(*buf, v, 10)
+	case float64:
+		b, err := json.Marshal(v)
+		if err != nil { // NaN and Inf have no JSON form
+			appendJSONString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+			return
+		}
+		*buf = append(*buf, b...)
+	case bool:
+		*buf = strconv.AppendBool(*buf, v)
+	case time.Duration:
+		appendJSONString(buf, v.String())
+	case time.Time:
+		appendJSONString(buf, v.Format(time.RFC3339Nano))
+	case json.Marshaler:
+		b, err := json.Marshal(v)
+		if err != nil {
+			appendJSONString(buf, fmt.Sprintf("!ERROR:%v", err))
+			return
+		}
+		*buf = append(*buf, b...)
+	case error:
+		if isNilPointer(v) {
+			*buf = append(*buf, "null"...)
+		} else {
+			appendJSONString(buf, v.Error())
+		}
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			*buf = append(*buf, "null"...)
+		} else {
+			appendJSONString(buf, v.String())
+		}
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			appendJSONString(buf, fmt.Sprint(v))
+			return
+		}
+		*buf = append(*buf, b...)
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString writes s to buf as a quoted JSON string.
+// Invalid UTF-8 is replaced with the escape \ufffd.
+func appendJSONString(buf *[]byte, s string) {
+	*buf = append(*buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			*buf = append(*buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				*buf = append(*buf, '\\', c)
+			case '\n':
+				*buf = append(*buf, '\\', 'n')
+			case '\r':
+				*buf = append(*buf, '\\', 'r')
+			case '\t':
+				*buf = append(*buf, '\\', 't')
+			default:
+				*buf = append(*buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			*buf = append(*buf, s[start:i]...)
+			*buf = append(*buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	*buf = append(*buf, s[start:]...)
+	*buf = append(*buf, '"')
+}
@@ -20,9 +20,16 @@ const (
 	FlagSFile              // final file name element and line number: d.go:23. overrides Llongfile
 	FlagUTC                // if Ldate or Ltime is set, use UTC rather than the local time zone
 	FlagPrefix             // move the "prefix" from the beginning of the line to before the message
-	FlagLevel
+	FlagLevel              // the level of the record: INFO
+	FlagJSON               // write each record as a JSON object instead of a text line
+	FlagLogfmt             // write each record as a logfmt line instead of a text line; FlagJSON takes precedence
+
 	FlagStd = FlagDate | FlagTime | FlagLevel // initial values for the standard logger
+)
 
+// Log levels, from the most to the least severe. A logger emits the
+// records whose level is less than or equal to its own.
+const (
 	LevelError = iota
 	LevelWarn
 	LevelInfo
@@ -34,13 +41,20 @@ const (
 // the Writer's Write method. A Logger can be used simultaneously from
 // multiple goroutines; it guarantees to serialize access to the Writer.
 type Logger struct {
-	mu        sync.Mutex // ensures atomic writes; protects the following fields
-	prefix    string     // prefix on each line to identify the logger (but see Lmsgprefix)
-	flag      int        // properties
-	out       io.Writer  // destination for output
-	buf       []byte     // for accumulating text to write
-	isDiscard int32      // atomic boolean: whether out == io.Discard
-	level     int        // log level: info, warn, error, debug
+	mu        sync.Mutex  // ensures atomic writes; protects the following fields
+	parentMu  *sync.Mutex // the lock shared with the parent logger, used in place of mu; see lock
+	prefix    string      // prefix on each line to identify the logger (but see Lmsgprefix)
+	flag      int         // properties
+	out       io.Writer   // destination for output
+	buf       []byte      // for accumulating text to write
+	isDiscard int32       // atomic boolean: whether out == io.Discard
+	level     int         // log level: info, warn, error, debug
+	formatter Formatter   // record layout; nil selects one from flag
+	name      string      // dotted logger name, see Named
+	fields    []Field     // fields added to every record, see With
+	sink      Sink        // receives records in place of formatter and out when set
+	layout    string      // time layout, see SetTimeLayout
+	clock     func() time.Time
 }
 
 // New creates a new Logger
@@ -52,17 +66,99 @@ func New(out io.Writer, prefix string, flag int, level int) *Logger {
 	return l
 }
 
+// With returns a child logger that adds the given fields to every record.
+// The arguments are handled like the keysAndValues of Infow.
+//
+// The child starts with a copy of the parent's prefix, flags, level,
+// formatter, name and fields and shares its writer and lock, so writes
+// through parent and child never interleave. Later Set calls on either
+// logger do not affect the other.
+func (l *Logger) With(keysAndValues ...any) *Logger {
+	c := l.clone()
+	if fields := fieldsOf(keysAndValues); len(fields) > 0 {
+		c.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	}
+	return c
+}
+
+// Named returns a child logger, like With, whose name is the parent's
+// name and name joined by a dot. Loggers without a name, such as those
+// returned by New, use name as it is.
+func (l *Logger) Named(name string) *Logger {
+	c := l.clone()
+	if c.name != "" && name != "" {
+		c.name = c.name + "." + name
+	} else if name != "" {
+		c.name = name
+	}
+	return c
+}
+
+// Name returns the dotted name of the logger, see Named.
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// lock returns the mutex guarding l: its own, or the one it shares with
+// the logger it was derived from by With or Named. A zero Logger uses
+// its own.
+func (l *Logger) lock() *sync.Mutex {
+	if l.parentMu != nil {
+		return l.parentMu
+	}
+	return &l.mu
+}
+
+func (l *Logger) clone() *Logger {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	return &Logger{
+		parentMu:  l.lock(),
+		prefix:    l.prefix,
+		flag:      l.flag,
+		out:       l.out,
+		isDiscard: atomic.LoadInt32(&l.isDiscard),
+		level:     l.level,
+		formatter: l.formatter,
+		name:      l.name,
+		fields:    l.fields,
+		sink:      l.sink,
+		layout:    l.layout,
+		clock:     l.clock,
+	}
+}
+
 // SetOutput sets the output destination for the logger.
 func (l *Logger) SetOutput(w io.Writer) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	l.out = w
 	isDiscard := int32(0)
-	if w == io.Discard {
+	if w == io.Discard && l.sink == nil {
+		isDiscard = 1
+	}
+	atomic.StoreInt32(&l.isDiscard, isDiscard)
+
+}
+
+// SetSink directs the logger's records to s instead of its formatter
+// and writer. A nil s restores output to the writer.
+func (l *Logger) SetSink(s Sink) {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	l.sink = s
+	isDiscard := int32(0)
+	if s == nil && l.out == io.Discard {
 		isDiscard = 1
 	}
 	atomic.StoreInt32(&l.isDiscard, isDiscard)
+}
 
+// Sink returns the sink set by SetSink, or nil.
+func (l *Logger) Sink() Sink {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	return l.sink
 }
 
 // Cheap integer to fixed-width decimal ASCII. Give a negative width to avoid zero-padding.
@@ -82,130 +178,108 @@ func itoa(buf *[]byte, i int, wid int) {
 	*buf = append(*buf, b[bp:]...)
 }
 
-// formatHeader writes log header to buf in following order:
-//   - l.prefix (if it's not blank and Lmsgprefix is unset),
-//   - date and/or time (if corresponding flags are provided),
-//   - file and line number (if corresponding flags are provided),
-//   - l.prefix (if it's not blank and Lmsgprefix is set).
-func (l *Logger) formatHeader(buf *[]byte, t time.Time, file string, line int, level ...int) {
-	if l.flag&FlagPrefix == 0 {
-		*buf = append(*buf, l.prefix...)
-	}
-	if l.flag&(FlagDate|FlagTime|FlagMtime) != 0 {
-		if l.flag&FlagUTC != 0 {
-			t = t.UTC()
-		}
-		if l.flag&FlagDate != 0 {
-			year, month, day := t.Date()
-			itoa(buf, year, 4)
-			*buf = append(*buf, '/')
-			itoa(buf, int(month), 2)
-			*buf = append(*buf, '/')
-			itoa(buf, day, 2)
-			*buf = append(*buf, ' ')
-		}
-		if l.flag&(FlagTime|FlagMtime) != 0 {
-			hour, min, sec := t.Clock()
-			itoa(buf, hour, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, min, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, sec, 2)
-			if l.flag&FlagMtime != 0 {
-				*buf = append(*buf, '.')
-				itoa(buf, t.Nanosecond()/1e3, 6)
-			}
-			*buf = append(*buf, ' ')
-		}
-	}
-	if l.flag&(FlagSFile|FlagLFile) != 0 {
-		if l.flag&FlagSFile != 0 {
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
-		}
-		*buf = append(*buf, file...)
-		*buf = append(*buf, ':')
-		itoa(buf, line, -1)
-		*buf = append(*buf, ' ')
-		//*buf = append(*buf, ": "...)
-	}
-	if l.flag&FlagLevel != 0 && len(level) > 0 {
-		switch {
-		case level[0] <= LevelError:
-			*buf = append(*buf, "ERROR "...)
-		case level[0] <= LevelWarn:
-			*buf = append(*buf, "WARN "...)
-		case level[0] <= LevelInfo:
-			*buf = append(*buf, "INFO "...)
-		default:
-			*buf = append(*buf, "DEBUG "...)
-		}
-	}
-	if l.flag&FlagPrefix != 0 {
-		*buf = append(*buf, l.prefix...)
-	}
-}
-
 func (l *Logger) Level() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	return l.level
 }
 
 func (l *Logger) LevelString() string {
+	return levelName(l.Level())
+}
+
+// levelName returns the upper-case name of level used in text output.
+func levelName(level int) string {
 	switch {
-	case l.level <= LevelError:
-		return "ERROR"
-	case l.level <= LevelWarn:
+	case level <= LevelError:
 		return "ERROR"
-	case l.level <= LevelInfo:
+	case level <= LevelWarn:
+		return "WARN"
+	case level <= LevelInfo:
 		return "INFO"
 	default:
 		return "DEBUG"
 	}
 }
 
+// levelKey returns the lower-case name of level used in structured output.
+func levelKey(level int) string {
+	switch {
+	case level <= LevelError:
+		return "error"
+	case level <= LevelWarn:
+		return "warn"
+	case level <= LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
 func (l *Logger) SetLevel(level int) {
 	if level > LevelDebug {
 		level = LevelDebug
 	} else if level < LevelError {
 		level = LevelError
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	l.level = level
 }
 
+// Output writes the output for a logging event. The string s contains
+// the text to print after the header specified by the flags of the
+// Logger. A newline is appended if the last character of s is not
+// already a newline. Calldepth is used to recover the PC and is
+// provided for generality, although at the moment on all pre-defined
+// paths it will be 2.
 func (l *Logger) Output(calldepth int, s string, level ...int) error {
-	now := time.Now() // get this early.
-	var file string
-	var line int
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	return l.output(calldepth+1, s, nil, level...) // +1 for this frame.
+}
+
+// output is Output with structured fields rendered after the message.
+func (l *Logger) output(calldepth int, s string, fields []Field, level ...int) error {
+	r := Record{Message: s, Fields: fields, HasLevel: len(level) > 0}
+	if r.HasLevel {
+		r.Level = level[0]
+	}
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	if l.clock != nil {
+		r.Time = l.clock()
+	} else {
+		r.Time = time.Now()
+	}
 	if l.flag&(FlagSFile|FlagLFile) != 0 {
 		// Release lock while getting caller info - it's expensive.
-		l.mu.Unlock()
+		l.lock().Unlock()
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		_, r.File, r.Line, ok = runtime.Caller(calldepth)
 		if !ok {
-			file = "???"
-			line = 0
+			r.File = "???"
+			r.Line = 0
 		}
-		l.mu.Lock()
+		l.lock().Lock()
 	}
-	l.buf = l.buf[:0]
-	l.formatHeader(&l.buf, now, file, line, level...)
-	l.buf = append(l.buf, s...)
-	if len(s) == 0 || s[len(s)-1] != '\n' {
-		l.buf = append(l.buf, '\n')
+	return l.emitLocked(&r)
+}
+
+// emitLocked completes r with the logger's name, prefix, flags and fields
+// and hands it to the sink, or formats it to the writer. l.lock() must be held.
+func (l *Logger) emitLocked(r *Record) error {
+	if len(l.fields) > 0 {
+		r.Fields = append(l.fields[:len(l.fields):len(l.fields)], r.Fields...)
 	}
-	_, err := l.out.Write(l.buf)
+	r.Name = l.name
+	r.Prefix = l.prefix
+	r.Flag = l.flag
+	r.TimeLayout = l.layout
+	if l.sink != nil {
+		return l.sink.Emit(r)
+	}
+	l.buf = l.buf[:0]
+	l.formatterLocked().Format(&l.buf, r)
+	_, err := writeLevel(l.out, r, l.buf)
 	return err
 }
 
@@ -278,37 +352,102 @@ func (l *Logger) Panicln(v ...any) {
 // Flags returns the output flags for the logger.
 // The flag bits are Ldate, Ltime, and so on.
 func (l *Logger) Flags() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	return l.flag
 }
 
 // SetFlags sets the output flags for the logger.
 // The flag bits are Ldate, Ltime, and so on.
 func (l *Logger) SetFlags(flag int) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	l.flag = flag
 }
 
 // Prefix returns the output prefix for the logger.
 func (l *Logger) Prefix() string {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	return l.prefix
 }
 
 // SetPrefix sets the output prefix for the logger.
 func (l *Logger) SetPrefix(prefix string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	l.prefix = prefix
 }
 
+// Formatter returns the formatter used to lay out records.
+// Unless SetFormatter was called, it is chosen from the flags.
+func (l *Logger) Formatter() Formatter {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	return l.formatterLocked()
+}
+
+// SetFormatter sets the formatter used to lay out records.
+// A nil formatter restores the default selected by the flags:
+// JSONFormatter for FlagJSON, LogfmtFormatter for FlagLogfmt and
+// TextFormatter otherwise.
+func (l *Logger) SetFormatter(f Formatter) {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	l.formatter = f
+}
+
+func (l *Logger) formatterLocked() Formatter {
+	if l.formatter != nil {
+		return l.formatter
+	}
+	return defaultFormatter(l.flag)
+}
+
+// defaultFormatter returns the formatter selected by flag.
+func defaultFormatter(flag int) Formatter {
+	switch {
+	case flag&FlagJSON != 0:
+		return JSONFormatter{}
+	case flag&FlagLogfmt != 0:
+		return LogfmtFormatter{}
+	default:
+		return TextFormatter{}
+	}
+}
+
+// TimeLayout returns the time layout set by SetTimeLayout.
+func (l *Logger) TimeLayout() string {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	return l.layout
+}
+
+// SetTimeLayout sets the layout of the record time: one of the Time
+// constants such as TimeRFC3339 or TimeUnixMilli, or any layout accepted
+// by time.Time.Format. In text output the time is then written in this
+// layout in place of the FlagDate, FlagTime and FlagMtime header; JSON
+// and logfmt output use it instead of RFC 3339. FlagUTC still applies.
+// An empty layout restores the default.
+func (l *Logger) SetTimeLayout(layout string) {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	l.layout = layout
+}
+
+// SetClock sets the function the logger calls for the time of each record,
+// time.Now by default. It is useful for deterministic output in tests.
+// A nil clock restores time.Now.
+func (l *Logger) SetClock(clock func() time.Time) {
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	l.clock = clock
+}
+
 // Writer returns the output destination for the logger.
 func (l *Logger) Writer() io.Writer {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lock().Lock()
+	defer l.lock().Unlock()
 	return l.out
 }
 
@@ -316,12 +455,12 @@ func (l *Logger) Error(format string, v ...any) {
 	if atomic.LoadInt32(&l.isDiscard) != 0 {
 		return
 	}
-	l.mu.Lock()
+	l.lock().Lock()
 	if l.level < LevelError {
-		l.mu.Unlock()
+		l.lock().Unlock()
 		return
 	}
-	l.mu.Unlock()
+	l.lock().Unlock()
 	l.Output(2, fmt.Sprintf(format, v...), LevelError)
 }
 
@@ -329,12 +468,12 @@ func (l *Logger) Warn(format string, v ...any) {
 	if atomic.LoadInt32(&l.isDiscard) != 0 {
 		return
 	}
-	l.mu.Lock()
+	l.lock().Lock()
 	if l.level < LevelWarn {
-		l.mu.Unlock()
+		l.lock().Unlock()
 		return
 	}
-	l.mu.Unlock()
+	l.lock().Unlock()
 	l.Output(2, fmt.Sprintf(format, v...), LevelWarn)
 }
 
@@ -342,12 +481,12 @@ func (l *Logger) Info(format string, v ...any) {
 	if atomic.LoadInt32(&l.isDiscard) != 0 {
 		return
 	}
-	l.mu.Lock()
+	l.lock().Lock()
 	if l.level < LevelInfo {
-		l.mu.Unlock()
+		l.lock().Unlock()
 		return
 	}
-	l.mu.Unlock()
+	l.lock().Unlock()
 	l.Output(2, fmt.Sprintf(format, v...), LevelInfo)
 }
 
@@ -355,12 +494,12 @@ func (l *Logger) Debug(format string, v ...any) {
 	if atomic.LoadInt32(&l.isDiscard) != 0 {
 		return
 	}
-	l.mu.Lock()
+	l.lock().Lock()
 	if l.level < LevelDebug {
-		l.mu.Unlock()
+		l.lock().Unlock()
 		return
 	}
-	l.mu.Unlock()
+	l.lock().Unlock()
 	l.Output(2, fmt.Sprintf(format, v...), LevelDebug)
 }
 
@@ -370,3 +509,60 @@ func (l *Logger) Log(level int, format string, v ...any) {
 	}
 	l.Output(2, fmt.Sprintf(format, v...), level)
 }
+
+// enabled reports whether the logger emits records at the given level.
+func (l *Logger) enabled(level int) bool {
+	if atomic.LoadInt32(&l.isDiscard) != 0 {
+		return false
+	}
+	l.lock().Lock()
+	defer l.lock().Unlock()
+	return level <= l.level
+}
+
+// Errorw logs a message at LevelError with structured fields.
+// The variadic arguments are alternating keys and values, or Field values:
+//
+//	l.Errorw("request failed", "user_id", 42, grlog.Err(err))
+func (l *Logger) Errorw(msg string, keysAndValues ...any) {
+	if !l.enabled(LevelError) {
+		return
+	}
+	l.output(2, msg, fieldsOf(keysAndValues), LevelError)
+}
+
+// Warnw logs a message at LevelWarn with structured fields.
+// See Errorw for the handling of keysAndValues.
+func (l *Logger) Warnw(msg string, keysAndValues ...any) {
+	if !l.enabled(LevelWarn) {
+		return
+	}
+	l.output(2, msg, fieldsOf(keysAndValues), LevelWarn)
+}
+
+// Infow logs a message at LevelInfo with structured fields.
+// See Errorw for the handling of keysAndValues.
+func (l *Logger) Infow(msg string, keysAndValues ...any) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.output(2, msg, fieldsOf(keysAndValues), LevelInfo)
+}
+
+// Debugw logs a message at LevelDebug with structured fields.
+// See Errorw for the handling of keysAndValues.
+func (l *Logger) Debugw(msg string, keysAndValues ...any) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.output(2, msg, fieldsOf(keysAndValues), LevelDebug)
+}
+
+// Logw logs a message at the given level with structured fields.
+// Like Log, it does not consult the logger's level.
+func (l *Logger) Logw(level int, msg string, keysAndValues ...any) {
+	if atomic.LoadInt32(&l.isDiscard) != 0 {
+		return
+	}
+	l.output(2, msg, fieldsOf(keysAndValues), level)
+}
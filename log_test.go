@@ -2,10 +2,17 @@ package grlog
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -89,3 +96,949 @@ func TestTimedRotateFile_Write(t *testing.T) {
 		//time.Sleep(time.Second)
 	}
 }
+
+func TestLoggerFields(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	log.Infow("request done", "user_id", 42, "path", "/a b", Duration("latency", 1500*time.Millisecond), "user name", "x", "dangling")
+	log.Debugw("hidden", "k", "v")
+	want := "INFO request done user_id=42 path=\"/a b\" latency=1.5s user_name=x !BADKEY=dangling\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "svc ", FlagJSON|FlagUTC|FlagSFile, LevelInfo)
+	log.Infow("say \"hi\"\n", "user_id", 42, "ok", true, "tags", []string{"a", "b"})
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("invalid json %q: %v", buf.String(), err)
+	}
+	if m["level"] != "info" || m["prefix"] != "svc " || m["msg"] != "say \"hi\"" || m["user_id"] != float64(42) || m["ok"] != true {
+		t.Errorf("unexpected record %q", buf.String())
+	}
+	if c, _ := m["caller"].(string); !strings.HasPrefix(c, "log_test.go:") {
+		t.Errorf("caller = %q", c)
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLogfmt, LevelInfo)
+	log.Warnw("disk almost full", "free", "1 GB", "bad key", "a=b", "n", 3)
+	got := buf.String()
+	want := ` level=warn msg="disk almost full" free="1 GB" bad_key="a=b" n=3` + "\n"
+	if !strings.HasPrefix(got, "ts=") || !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want suffix %q", got, want)
+	}
+}
+
+type nilError struct{ msg string }
+
+func (e *nilError) Error() string { return e.msg }
+
+func TestLoggerNilPointerFields(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	log.Infow("failed", Err((*nilError)(nil)), "at", (*time.Time)(nil))
+	want := "INFO failed error=<nil> at=<nil>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+	log.SetFlags(FlagLogfmt)
+	log.Infow("failed", Err((*nilError)(nil)))
+	if got := buf.String(); !strings.HasSuffix(got, " error=<nil>\n") {
+		t.Errorf("logfmt got %q", got)
+	}
+	buf.Reset()
+	log.SetFlags(FlagJSON)
+	log.Infow("failed", Err((*nilError)(nil)), "at", (*time.Time)(nil))
+	if got := buf.String(); !strings.HasSuffix(got, `"error":null,"at":null}`+"\n") {
+		t.Errorf("json got %q", got)
+	}
+}
+
+type upperFormatter struct{}
+
+func (upperFormatter) Format(buf *[]byte, r *Record) {
+	*buf = append(*buf, strings.ToUpper(r.Message)...)
+	*buf = append(*buf, '\n')
+}
+
+func TestLoggerFormatter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagJSON, LevelInfo)
+	if _, ok := log.Formatter().(JSONFormatter); !ok {
+		t.Fatalf("default formatter for FlagJSON is %T", log.Formatter())
+	}
+	log.SetFormatter(upperFormatter{})
+	log.Info("hello")
+	if got := buf.String(); got != "HELLO\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	auth := log.Named("api").With("request_id", "r1").Named("auth")
+	auth.With("user_id", 7).Infow("login", "ok", true)
+	log.Info("plain")
+	want := "INFO [api.auth] login request_id=r1 user_id=7 ok=true\nINFO plain\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if auth.Name() != "api.auth" {
+		t.Errorf("Name() = %q", auth.Name())
+	}
+}
+
+type requestIDKey struct{}
+
+func TestLoggerContext(t *testing.T) {
+	t.Cleanup(RegisterContextExtractor(ContextValue("request_id", requestIDKey{})))
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "r1")
+	ctx = NewContext(ctx, log.Named("api"))
+	InfoCtx(ctx, "handled %d", 3)
+	log.WarnCtx(context.Background(), "no id")
+	want := "INFO [api] handled 3 request_id=r1\nWARN no id\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if FromContext(context.Background()) != Default() {
+		t.Error("FromContext without a logger should return the standard logger")
+	}
+}
+
+func TestLoggerTee(t *testing.T) {
+	all, warn, errs := bytes.NewBuffer(nil), bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	log := New(io.Discard, "", FlagLevel, LevelDebug)
+	log.SetSink(Tee(
+		NewWriterSink(all, LevelDebug, nil),
+		NewWriterSink(warn, LevelWarn, nil),
+		LevelSink(NewWriterSink(errs, LevelDebug, LogfmtFormatter{}), LevelError),
+	))
+	log.Debug("d")
+	log.Warn("w")
+	log.Error("e")
+	if got := all.String(); got != "DEBUG d\nWARN w\nERROR e\n" {
+		t.Errorf("all got %q", got)
+	}
+	if got := warn.String(); got != "WARN w\nERROR e\n" {
+		t.Errorf("warn got %q", got)
+	}
+	if got := errs.String(); !strings.HasSuffix(got, " level=error msg=e\n") || strings.Count(got, "\n") != 1 {
+		t.Errorf("errors got %q", got)
+	}
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	if f := NewConsoleFormatter(buf); f.Color {
+		t.Error("color enabled for a non-terminal writer")
+	}
+	log.SetFormatter(&ConsoleFormatter{Color: true, Align: true})
+	log.Info("started")
+	want := "\x1b[32mINFO\x1b[0m  started\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoggerTimeLayout(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagStd|FlagUTC, LevelInfo)
+	log.SetClock(func() time.Time { return time.Date(2009, 1, 23, 1, 23, 23, 123456789, time.UTC) })
+	log.Info("default")
+	log.SetTimeLayout(TimeRFC3339Nano)
+	log.Info("rfc3339")
+	log.SetTimeLayout(TimeUnixMilli)
+	log.SetFlags(FlagJSON)
+	log.Info("json")
+	want := "2009/01/23 01:23:23 INFO default\n" +
+		"2009-01-23T01:23:23.123456789Z INFO rfc3339\n" +
+		`{"time":1232673803123,"level":"info","msg":"json"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRotateFileCompress(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "c.log")
+	writer, err := NewRotateFile(name, 2, 1024, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.SetCompress(true)
+	line := []byte(strings.Repeat("x", 399) + "\n")
+	for i := 0; i < 7; i++ {
+		if _, err := writer.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, backup := range []string{name + "-1.gz", name + "-2.gz"} {
+		f, err := os.Open(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil || len(data) != 2*len(line) {
+			t.Errorf("%s: %d bytes, %v", backup, len(data), err)
+		}
+	}
+	if _, err := os.Stat(name + "-3.gz"); !os.IsNotExist(err) {
+		t.Errorf("backup beyond backupCount: %v", err)
+	}
+}
+
+func TestRotateFileMaxAge(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "m.log")
+	old := time.Now().Add(-48 * time.Hour)
+	for _, backup := range []string{name + "-1", name + "-3.gz"} {
+		if err := os.WriteFile(backup, []byte("old\n"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(name+"-3.gz", old, old); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := NewRotateFile(name, 5, 1024, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.SetMaxAge(24 * time.Hour)
+	line := []byte(strings.Repeat("x", 599) + "\n")
+	writer.Write(line)
+	writer.Write(line) // rotates
+	writer.shifts.wait()
+	if _, err := os.Stat(name + "-2"); err != nil {
+		t.Errorf("recent backup removed: %v", err)
+	}
+	if _, err := os.Stat(name + "-4.gz"); !os.IsNotExist(err) {
+		t.Errorf("expired backup kept: %v", err)
+	}
+}
+
+func TestTimedRotateFileMaxTotalSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "s.log")
+	for i, date := range []string{"2023-12-01", "2023-12-02", "2023-12-03"} {
+		backup := name + "-" + date
+		if err := os.WriteFile(backup, bytes.Repeat([]byte("x"), 1000), 0664); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(i-10) * time.Hour)
+		if err := os.Chtimes(backup, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer, err := NewTimedRotateFile(name, 10, 1024, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.SetMaxTotalSize(2500)
+	line := []byte(strings.Repeat("x", 599) + "\n")
+	writer.Write(line)
+	writer.Write(line) // rotates: 3000 bytes of old backups + 600 new, over budget
+	for _, date := range []string{"2023-12-01", "2023-12-02"} {
+		if _, err := os.Stat(name + "-" + date); !os.IsNotExist(err) {
+			t.Errorf("backup %s kept: %v", date, err)
+		}
+	}
+	if _, err := os.Stat(name + "-2023-12-03"); err != nil {
+		t.Errorf("newest old backup removed: %v", err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		schedule Schedule
+		now      string
+		next     string
+	}{
+		{Daily, "2023-12-01 23:59:59", "2023-12-02 00:00:00"},
+		{Hourly, "2023-12-01 13:00:00", "2023-12-01 14:00:00"},
+		{Every(15 * time.Minute), "2023-12-01 13:07:10", "2023-12-01 13:15:00"},
+		{Every(7 * time.Hour), "2023-12-01 22:00:00", "2023-12-02 00:00:00"},
+		{Weekly, "2023-12-03 10:00:00", "2023-12-04 00:00:00"},
+		{Weekly, "2023-12-04 00:00:00", "2023-12-11 00:00:00"},
+		{Monthly, "2023-12-15 10:00:00", "2024-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.Next(at(tt.now)); !got.Equal(at(tt.next)) {
+			t.Errorf("%#v.Next(%s) = %s, want %s", tt.schedule, tt.now, got, tt.next)
+		}
+	}
+	pattern := backupPattern("a.log", Hourly.Layout())
+	for name, want := range map[string]bool{
+		"a.log-2024-01-01T13":      true,
+		"a.log-2024-01-01T13-2.gz": true,
+		"a.log-2024-01-01":         false,
+		"aalog-2024-01-01T13":      false,
+	} {
+		if pattern.MatchString(name) != want {
+			t.Errorf("pattern match %s != %v", name, want)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	s, err := ParseCron("30 2 * * *; 0 0 * * sun", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2023, 12, 1, 3, 0, 0, 0, time.UTC) // Friday
+	for _, want := range []time.Time{
+		time.Date(2023, 12, 2, 2, 30, 0, 0, time.UTC),
+		time.Date(2023, 12, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 12, 3, 2, 30, 0, 0, time.UTC),
+	} {
+		if from = s.Next(from); !from.Equal(want) {
+			t.Fatalf("Next = %s, want %s", from, want)
+		}
+	}
+	for _, spec := range []string{"* * *", "61 * * * *", "* * * foo *", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseCron(spec, nil); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", spec)
+		}
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, _ = ParseCron("30 2 * * *", ny)
+	got := s.Next(time.Date(2024, 3, 9, 3, 0, 0, 0, ny))
+	if want := time.Date(2024, 3, 11, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("across spring forward: Next = %s, want %s", got, want)
+	}
+	s, _ = ParseCron("30 1 * * *", ny)
+	first := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(ny) // 01:30 EDT
+	got = s.Next(first)
+	if want := time.Date(2024, 11, 4, 1, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("across fall back: Next = %s, want %s", got, want)
+	}
+}
+
+func TestRotateFileReopen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "r.log")
+	writer, err := NewRotateFile(name, 3, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	RegisterReopener(writer)
+	defer UnregisterReopener(writer)
+	writer.Write([]byte("first\n"))
+	if err := writer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("second\n"))
+	// logrotate "create": the file is moved away, then grlog is told to reopen
+	if err := os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenAll(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("third\n"))
+	for file, want := range map[string]string{name + "-1": "first\n", name + ".moved": "second\n", name: "third\n"} {
+		if data, err := os.ReadFile(file); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", file, data, err, want)
+		}
+	}
+}
+
+func TestNewTimedRotateFileWithOptions(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logs", "o.log")
+	writer, err := NewTimedRotateFileWithOptions(FileOptions{
+		FileName:     name,
+		BackupCount:  3,
+		FileMode:     0600,
+		DirMode:      0700,
+		Schedule:     Hourly,
+		BackupLayout: "20060102T15",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("hello\n"))
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("file mode: %v, %v", fi.Mode(), err)
+	}
+	if fi, err := os.Stat(filepath.Dir(name)); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("dir mode: %v, %v", fi.Mode(), err)
+	}
+	backup := name + "-" + fi.ModTime().Format("20060102T15")
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+	if _, err := NewRotateFileWithOptions(FileOptions{FileName: name, MaxSize: 100}); err == nil {
+		t.Error("MaxSize below 1024 accepted")
+	}
+	for _, layout := range []string{"2006-Jan-02", "2006-01-02 MST", "2006-01-02Z07:00"} {
+		if _, err := NewTimedRotateFileWithOptions(FileOptions{FileName: name, BackupLayout: layout}); err == nil {
+			t.Errorf("BackupLayout %q accepted", layout)
+		}
+	}
+}
+
+func TestRotateFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	writer, err := NewRotateFileWithOptions(FileOptions{FileName: name, BackupCount: 2, Symlink: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(writer, "file %d\n", i)
+		if err := writer.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Write([]byte("current\n"))
+	if fi, err := os.Lstat(name); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s is not a symlink: %v", name, err)
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != "current\n" {
+		t.Errorf("link target holds %q, %v", data, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(files) != 3 { // the active file and two backups
+		t.Errorf("files = %v", files)
+	}
+}
+
+func TestRotateFileCallbacks(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cb.log")
+	var mu sync.Mutex
+	var events []string
+	writer, err := NewRotateFileWithOptions(FileOptions{
+		FileName:    name,
+		BackupCount: 1,
+		OnRotate: func(oldPath, newPath string) {
+			time.Sleep(10 * time.Millisecond) // a slow upload
+			data, err := os.ReadFile(oldPath)
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, fmt.Sprintf("rotate %s %s %q %v", filepath.Base(oldPath), filepath.Base(newPath), data, err))
+		},
+		OnPrune: func(path string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "prune "+filepath.Base(path))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		writer.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		if err := writer.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close() // waits for the callbacks
+	mu.Lock()
+	defer mu.Unlock()
+	// each backup is still in place when its callback runs
+	want := []string{`rotate cb.log-1 cb.log "line 0\n" <nil>`, "prune cb.log-1", `rotate cb.log-1 cb.log "line 1\n" <nil>`}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events = %q; want %q", events, want)
+	}
+}
+
+func TestRotateFileSlowCallback(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "slow.log")
+	var writer *RotateFile
+	var mu sync.Mutex
+	var errs []string
+	writer, err := NewRotateFileWithOptions(FileOptions{
+		FileName:    name,
+		BackupCount: 2,
+		MaxSize:     1024,
+		Compress:    true,
+		OnRotate: func(oldPath, newPath string) {
+			// a slow upload, logging to the file being rotated
+			fmt.Fprintf(writer, "uploading %s\n", filepath.Base(oldPath))
+			time.Sleep(100 * time.Millisecond)
+			if _, err := os.Stat(oldPath); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			line := []byte(strings.Repeat("x", 99) + "\n")
+			for i := 0; i < 50; i++ {
+				start := time.Now()
+				writer.Write(line)
+				if d := time.Since(start); d > 50*time.Millisecond {
+					t.Errorf("write %d of goroutine %d took %v", i, g, d)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) > 0 {
+		t.Errorf("backups moved before their callback returned: %q", errs)
+	}
+	for _, backup := range []string{name + "-1.gz", name + "-2.gz"} {
+		if _, err := os.Stat(backup); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRotateFileHeader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "h.log")
+	opts := FileOptions{FileName: name, BackupCount: 2, Header: StandardHeader("v1.2.3", "text")}
+	writer, err := NewRotateFileWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("first\n"))
+	if err := writer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("second\n"))
+	writer.Close()
+	// reopening a file that is not empty does not repeat the header
+	writer, err = NewRotateFileWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("third\n"))
+	writer.Close()
+	want := fmt.Sprintf(" pid=%d version=v1.2.3 start=", os.Getpid())
+	for file, lines := range map[string]string{name + "-1": "first\n", name: "second\nthird\n"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, rest, _ := strings.Cut(string(data), "\n")
+		if !strings.HasPrefix(header, "# host=") || !strings.Contains(header, want) || !strings.HasSuffix(header, " schema=text") {
+			t.Errorf("%s header = %q", file, header)
+		}
+		if rest != lines {
+			t.Errorf("%s = %q; want %q", file, rest, lines)
+		}
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		policy OverflowPolicy
+		want   string
+	}{
+		{OverflowDropNewest, "0 1 2"},
+		{OverflowDropOldest, "0 2 3"},
+		{OverflowDropBelow, "0 1 3"},
+	} {
+		var mu sync.Mutex
+		var written []string
+		started, release := make(chan struct{}), make(chan struct{})
+		a := newAsyncWriter(FileOptions{BufferSize: 2, Overflow: tt.policy, OverflowLevel: LevelInfo}, func(level int, p []byte) (int, error) {
+			if string(p) == "0" {
+				close(started)
+				<-release // the disk is slow
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			written = append(written, string(p))
+			return len(p), nil
+		})
+		a.enqueue(LevelInfo, []byte("0"))
+		<-started
+		a.enqueue(LevelInfo, []byte("1"))
+		a.enqueue(LevelDebug, []byte("2"))
+		a.enqueue(LevelError, []byte("3")) // the queue is full
+		close(release)
+		a.close()
+		if got := strings.Join(written, " "); got != tt.want || a.droppedCount() != 1 {
+			t.Errorf("policy %d: written %q, dropped %d; want %q, 1", tt.policy, got, a.droppedCount(), tt.want)
+		}
+	}
+}
+
+func TestAsyncDrain(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "drain.log")
+	writer, err := NewRotateFileWithOptions(FileOptions{FileName: name, Async: true, BufferSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New(writer, "", 0, LevelInfo)
+	for i := 0; i < 1000; i++ {
+		log.Print(i) // reuses the logger's buffer for each record
+	}
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	log.Print("last")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 1001 || lines[1000] != "last" {
+		t.Fatalf("got %d lines, last %q", len(lines), lines[len(lines)-1])
+	}
+	for i, line := range lines[:1000] {
+		if line != strconv.Itoa(i) {
+			t.Fatalf("line %d = %q", i, line)
+		}
+	}
+	if _, err := writer.Write([]byte("closed\n")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestAsyncCloseTimeout(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var closed atomic.Bool
+	a := newAsyncWriter(FileOptions{BufferSize: 10, CloseTimeout: 10 * time.Millisecond}, func(level int, p []byte) (int, error) {
+		started <- struct{}{}
+		<-release // the disk hangs
+		if closed.Load() {
+			t.Errorf("record %q written after close", p)
+		}
+		return len(p), nil
+	})
+	a.enqueue(LevelInfo, []byte("0"))
+	<-started
+	a.enqueue(LevelInfo, []byte("1"))
+	a.enqueue(LevelInfo, []byte("2"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("flush = %v; want %v", err, context.DeadlineExceeded)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	err := a.close()
+	closed.Store(true)
+	if err == nil || !strings.Contains(err.Error(), " 2 queued records dropped") {
+		t.Errorf("close = %v; want 2 records dropped", err)
+	}
+	if n := a.droppedCount(); n != 2 {
+		t.Errorf("dropped %d records; want 2", n)
+	}
+
+	// records taken from the queue but not written yet are dropped too
+	dir := t.TempDir()
+	const count = 5000
+	writer, err := NewRotateFileWithOptions(FileOptions{
+		FileName:     filepath.Join(dir, "timeout.log"),
+		BackupCount:  100,
+		MaxSize:      4096,
+		Async:        true,
+		BufferSize:   count,
+		SyncPolicy:   SyncAlways,
+		CloseTimeout: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+	err = writer.Close()
+	names := func() []string {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+	files := names()
+	written := 0
+	for _, name := range files {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		written += bytes.Count(data, []byte("\n"))
+	}
+	dropped := writer.Dropped()
+	if written+int(dropped) != count {
+		t.Errorf("%d records written, %d dropped; want %d in total", written, dropped, count)
+	}
+	if dropped > 0 && (err == nil || !strings.Contains(err.Error(), fmt.Sprintf(" %d queued records dropped", dropped))) {
+		t.Errorf("close = %v; want %d records dropped", err, dropped)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if later := names(); len(later) != len(files) {
+		t.Errorf("%d files after close, then %d", len(files), len(later))
+	}
+}
+
+func TestRotateFileWriteBuffer(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "buf.log")
+	writer, err := NewRotateFileWithOptions(FileOptions{FileName: name, WriteBufferSize: 4096, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New(writer, "", FlagLevel, LevelInfo)
+	check := func(want string) {
+		t.Helper()
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("file = %q, %v; want %q", data, err, want)
+		}
+	}
+	log.Info("one")
+	log.Info("two")
+	check("")
+	log.Error("three") // written at once, with the records before it
+	check("INFO one\nINFO two\nERROR three\n")
+	log.Info("four")
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check("INFO one\nINFO two\nERROR three\nINFO four\n")
+	log.Info("five")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check("INFO one\nINFO two\nERROR three\nINFO four\nINFO five\n")
+
+	// the timer writes records that wait for the flush interval
+	writer, err = NewRotateFileWithOptions(FileOptions{FileName: name, WriteBufferSize: 4096, FlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.Write([]byte("six\n"))
+	for i := 0; i < 100; i++ {
+		if data, _ := os.ReadFile(name); strings.HasSuffix(string(data), "six\n") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("buffered record not written after the flush interval")
+}
+
+// statFile writes like the rotators did before they tracked the size of
+// the file: with a Stat before each write to decide whether to rotate.
+type statFile struct {
+	mu      sync.Mutex
+	file    *os.File
+	maxSize int64
+}
+
+func (f *statFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fi, err := f.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size()+int64(len(p)) >= f.maxSize {
+		return 0, io.ErrShortWrite // not reached: rotation is not measured
+	}
+	return f.file.Write(p)
+}
+
+func benchmarkWrite(b *testing.B, w io.Writer) {
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	b.SetBytes(int64(len(line)))
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := w.Write(line); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkWriteStatSize(b *testing.B) {
+	file, err := openFile(filepath.Join(b.TempDir(), "stat.log"), defaultFileMode)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	benchmarkWrite(b, &statFile{file: file, maxSize: 1 << 40})
+}
+
+func BenchmarkWriteCachedSize(b *testing.B) {
+	writer, err := NewRotateFile(filepath.Join(b.TempDir(), "cached.log"), 1, 1<<40, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer writer.Close()
+	benchmarkWrite(b, writer)
+}
+
+func TestSyncPolicy(t *testing.T) {
+	if s := newSyncer(FileOptions{SyncPolicy: SyncNever}, nil); s.wrote() {
+		t.Error("SyncNever synced")
+	}
+	if s := newSyncer(FileOptions{SyncPolicy: SyncAlways}, nil); !s.wrote() {
+		t.Error("SyncAlways did not sync")
+	}
+	s := newSyncer(FileOptions{SyncPolicy: SyncEveryN, SyncEvery: 3}, nil)
+	var got []bool
+	for i := 0; i < 4; i++ {
+		due := s.wrote()
+		if due {
+			s.synced()
+		}
+		got = append(got, due)
+	}
+	if fmt.Sprint(got) != "[false false true false]" {
+		t.Errorf("SyncEveryN: %v", got)
+	}
+	timed := make(chan struct{}, 1)
+	s = newSyncer(FileOptions{SyncPolicy: SyncPeriodic, SyncInterval: time.Millisecond}, func() { timed <- struct{}{} })
+	if s.wrote() {
+		t.Error("SyncPeriodic synced at once")
+	}
+	select {
+	case <-timed:
+	case <-time.After(time.Second):
+		t.Error("SyncPeriodic did not sync after the interval")
+	}
+
+	// syncing writes the buffered records first
+	name := filepath.Join(t.TempDir(), "sync.log")
+	writer, err := NewRotateFileWithOptions(FileOptions{FileName: name, WriteBufferSize: 4096,
+		FlushInterval: time.Hour, SyncPolicy: SyncEveryN, SyncEvery: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	for i, want := range []string{"", "1\n2\n"} {
+		writer.Write([]byte(strconv.Itoa(i+1) + "\n"))
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("after %d records file = %q; want %q", i+1, data, want)
+		}
+	}
+	writer.Write([]byte("3\n"))
+	if err := writer.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "1\n2\n3\n" {
+		t.Errorf("after Sync file = %q", data)
+	}
+	writer.Write([]byte("4\n"))
+	if err := writer.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.syncer.dirty() {
+		t.Error("Reopen did not sync the old file")
+	}
+	if data, _ := os.ReadFile(name); string(data) != "1\n2\n3\n4\n" {
+		t.Errorf("after Reopen file = %q", data)
+	}
+}
+
+func TestLoggerZeroValue(t *testing.T) {
+	var l Logger
+	buf := bytes.NewBuffer(nil)
+	l.SetOutput(buf)
+	l.Print("zero")
+	l.With("k", "v").Print("child")
+	if got, want := buf.String(), "zero\nchild k=v\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimedRotateFileWriteBuffer(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "tb.log")
+	writer, err := NewTimedRotateFileWithOptions(FileOptions{
+		FileName:        name,
+		BackupCount:     3,
+		Schedule:        Every(time.Second),
+		WriteBufferSize: 4096,
+		FlushInterval:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	afterBoundary := func() time.Time {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Second).Add(time.Second + 100*time.Millisecond).Sub(now))
+		return time.Now()
+	}
+	written := afterBoundary()
+	writer.Write([]byte("a\n")) // buffered
+	afterBoundary()
+	writer.Write([]byte("b\n")) // rotates, flushing "a" after the boundary
+	backup := name + "-" + written.Format(Every(time.Second).Layout())
+	if data, err := os.ReadFile(backup); err != nil || string(data) != "a\n" {
+		t.Errorf("%s = %q, %v; want %q", backup, data, err, "a\n")
+	}
+}
+
+func TestRotateFileCopyTruncate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ct.log")
+	writer, err := NewRotateFile(name, 2, 2048, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	line := []byte(strings.Repeat("x", 499) + "\n")
+	for i := 0; i < 3; i++ {
+		writer.Write(line)
+	}
+	// logrotate copytruncate: the file is copied, then truncated in place
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(line)
+	writer.Write(line)
+	if _, err := os.Stat(name + "-1"); !os.IsNotExist(err) {
+		t.Errorf("rotated after truncation: %v", err)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Size() != 1000 {
+		t.Errorf("file size = %v, %v; want 1000", fi.Size(), err)
+	}
+}
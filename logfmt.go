@@ -0,0 +1,75 @@
+package grlog
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtFormatter is a Formatter that writes each record as a logfmt line:
+//
+//	ts=2009-01-23T01:23:23.123123+08:00 level=info caller=d.go:23 msg="hello world" key=value
+//
+// logger and prefix are omitted when blank, level when the record has
+// none and caller unless FlagSFile or FlagLFile is set.
+type LogfmtFormatter struct{}
+
+// Format implements Formatter.
+func (LogfmtFormatter) Format(buf *[]byte, r *Record) {
+	t := r.Time
+	if r.Flag&FlagUTC != 0 {
+		t = t.UTC()
+	}
+	*buf = append(*buf, "ts="...)
+	if r.TimeLayout == "" {
+		*buf = t.AppendFormat(*buf, time.RFC3339Nano)
+	} else {
+		var ts []byte
+		appendTime(&ts, t, r.TimeLayout)
+		appendValue(buf, string(ts))
+	}
+	if r.HasLevel {
+		*buf = append(*buf, " level="...)
+		*buf = append(*buf, levelKey(r.Level)...)
+	}
+	if r.Name != "" {
+		*buf = append(*buf, " logger="...)
+		appendValue(buf, r.Name)
+	}
+	if r.Prefix != "" {
+		*buf = append(*buf, " prefix="...)
+		appendValue(buf, r.Prefix)
+	}
+	if r.Flag&(FlagSFile|FlagLFile) != 0 {
+		*buf = append(*buf, " caller="...)
+		appendValue(buf, caller(r.File, r.Line, r.Flag))
+	}
+	msg := r.Message
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	*buf = append(*buf, " msg="...)
+	appendValue(buf, msg)
+	for _, f := range r.Fields {
+		*buf = append(*buf, ' ')
+		appendLogfmtKey(buf, f.Key)
+		*buf = append(*buf, '=')
+		appendValue(buf, f.Value)
+	}
+	*buf = append(*buf, '\n')
+}
+
+// appendLogfmtKey writes key to buf, replacing the characters a logfmt
+// key may not contain with '_'.
+func appendLogfmtKey(buf *[]byte, key string) {
+	if key == "" {
+		*buf = append(*buf, '_')
+		return
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			*buf = append(*buf, '_')
+		} else {
+			*buf = utf8.AppendRune(*buf, r)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package grlog
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	defaultFileMode  os.FileMode = 0664
+	defaultDirMode   os.FileMode = 0775
+	defaultQueueSize             = 10
+)
+
+// FileOptions configures a RotateFile or a TimedRotateFile. The zero
+// value of each field selects its default.
+type FileOptions struct {
+	// FileName is the path of the log file: a/b/c.log. Missing
+	// directories are created.
+	FileName string
+	// BackupCount is the number of backups to keep. With 0 the file
+	// never rotates.
+	BackupCount int
+	// MaxSize is the size at which the file rotates, 16 MiB by default
+	// and at least 1024.
+	MaxSize int64
+	// Async enables asynchronous writes: Write queues the record, and a
+	// separate goroutine writes it.
+	Async bool
+	// BufferSize is the depth of the queue in async mode, 10 records by
+	// default.
+	BufferSize int
+	// Overflow decides what Write does when the async queue is full,
+	// OverflowBlock by default. See Dropped.
+	Overflow OverflowPolicy
+	// OverflowLevel is the least severe level that OverflowDropBelow
+	// keeps, LevelError by default.
+	OverflowLevel int
+	// WriteBufferSize is the number of bytes of records buffered before
+	// they are written in one go. A buffer is also written when a
+	// LevelError record is written, after FlushInterval, and by Flush,
+	// Close, Rotate and Reopen. 0, the default, writes each record at
+	// once.
+	WriteBufferSize int
+	// FlushInterval is how long records may wait in the write buffer,
+	// one second by default.
+	FlushInterval time.Duration
+	// SyncPolicy decides when the file is synced to disk, SyncNever by
+	// default. See Sync.
+	SyncPolicy SyncPolicy
+	// SyncEvery is the number of records between syncs with SyncEveryN,
+	// 100 by default.
+	SyncEvery int
+	// SyncInterval is how long written records may wait for a sync with
+	// SyncPeriodic, one second by default.
+	SyncInterval time.Duration
+	// CloseTimeout bounds how long Close waits for the async queue to
+	// be written; after it Close only waits for the record being
+	// written, and drops the rest. By default Close waits until all are
+	// written.
+	CloseTimeout time.Duration
+	// FileMode is the permission of the log file and backups, 0664 by default.
+	FileMode os.FileMode
+	// DirMode is the permission of created directories, 0775 by default.
+	DirMode os.FileMode
+	// Compress enables gzip compression of backups, see SetCompress.
+	Compress bool
+	// MaxAge removes backups older than MaxAge, see SetMaxAge.
+	MaxAge time.Duration
+	// MaxTotalSize bounds the size of the file and its backups, see
+	// SetMaxTotalSize.
+	MaxTotalSize int64
+	// Schedule is when a TimedRotateFile rotates, Daily by default.
+	// Unused by RotateFile.
+	Schedule Schedule
+	// BackupLayout is the time layout of TimedRotateFile backup names,
+	// the layout of Schedule by default. It must contain only numeric
+	// elements. Unused by RotateFile.
+	BackupLayout string
+	// Symlink makes FileName a symlink to the active file, which is
+	// uniquely named after its creation time: app.log points at
+	// app-20240101T130000.log. A rotation starts a new file and
+	// atomically updates the link, so tools like tail -F can follow
+	// FileName; backups are the previous files, kept by age and count
+	// instead of being renamed. A TimedRotateFile names its files after
+	// BackupLayout without dashes: app-20240101T13.log for Hourly.
+	Symlink bool
+	// Header writes the first lines of each new file, see SetHeader.
+	Header HeaderFunc
+	// OnRotate, OnPrune and OnError are lifecycle callbacks, see
+	// RotateFile.OnRotate.
+	OnRotate func(oldPath, newPath string)
+	OnPrune  func(path string)
+	OnError  func(err error)
+}
+
+// withDefaults returns o with the defaults filled in, or an error if o
+// is invalid.
+func (o FileOptions) withDefaults() (FileOptions, error) {
+	if o.FileName == "" {
+		return o, errors.New("file name is required")
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = defaultFileSize
+	} else if o.MaxSize < 1024 {
+		return o, errors.New("file size must be than greater 1024")
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = defaultQueueSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultFlushInterval
+	}
+	if o.SyncEvery <= 0 {
+		o.SyncEvery = defaultSyncEvery
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = defaultSyncInterval
+	}
+	if o.FileMode == 0 {
+		o.FileMode = defaultFileMode
+	}
+	if o.DirMode == 0 {
+		o.DirMode = defaultDirMode
+	}
+	if o.Schedule == nil {
+		o.Schedule = Daily
+	}
+	if o.BackupLayout == "" {
+		o.BackupLayout = o.Schedule.Layout()
+	}
+	if err := checkLayout(o.BackupLayout); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// openFile opens the log file name for appending, creating it with mode.
+func openFile(name string, mode os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, mode)
+}
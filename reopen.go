@@ -0,0 +1,94 @@
+package grlog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// A Reopener is a log file that can reopen itself by name after an
+// external tool such as logrotate moved it away. RotateFile and
+// TimedRotateFile are Reopeners.
+type Reopener interface {
+	Reopen() error
+}
+
+var reopeners struct {
+	mu    sync.Mutex
+	files []Reopener
+}
+
+// RegisterReopener adds f to the files reopened by ReopenAll.
+func RegisterReopener(f Reopener) {
+	reopeners.mu.Lock()
+	defer reopeners.mu.Unlock()
+	reopeners.files = append(reopeners.files, f)
+}
+
+// UnregisterReopener removes f from the files reopened by ReopenAll.
+func UnregisterReopener(f Reopener) {
+	reopeners.mu.Lock()
+	defer reopeners.mu.Unlock()
+	for i, r := range reopeners.files {
+		if r == f {
+			reopeners.files = append(reopeners.files[:i], reopeners.files[i+1:]...)
+			return
+		}
+	}
+}
+
+// ReopenAll reopens all registered files. It returns the first error,
+// after trying every file.
+func ReopenAll() error {
+	reopeners.mu.Lock()
+	defer reopeners.mu.Unlock()
+	var first error
+	for _, f := range reopeners.files {
+		if err := f.Reopen(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ReopenOnSignal calls ReopenAll whenever the process receives one of
+// sigs, so that grlog cooperates with logrotate's "create" mode:
+//
+//	writer, _ := grlog.NewRotateFile("/var/log/app.log", 0, 0, false)
+//	grlog.RegisterReopener(writer)
+//	stop := grlog.ReopenOnSignal()
+//	defer stop()
+//
+// Without sigs it listens for SIGHUP and SIGUSR1 where the platform has
+// them. Reopen errors are reported on standard error. The returned
+// function stops listening.
+func ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = reopenSignals
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	if len(sigs) > 0 {
+		signal.Notify(c, sigs...)
+	}
+	go func() {
+		for {
+			select {
+			case <-c:
+				if err := ReopenAll(); err != nil {
+					fmt.Fprintf(os.Stderr, "grlog: reopen: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
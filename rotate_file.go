@@ -1,22 +1,37 @@
 package grlog
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"path"
+	"regexp"
 	"sync"
+	"time"
 )
 
 type RotateFile struct {
 	file        *os.File
 	fileName    string
+	fileMode    os.FileMode
+	active      string // path of the file being written, see FileOptions.Symlink
+	symlink     bool
 	maxFileSize int64
 	backupCount int
 	mutex       sync.Mutex
-	async       bool //async write
-	writeChan   chan []byte
-	errorChan   chan error
+	async       *asyncWriter   // nil unless writing asynchronously
+	buffer      *writeBuffer   // nil unless buffering writes
+	syncer      *syncer        // nil for SyncNever
+	compress    bool           // gzip backups after rotation
+	compressing sync.WaitGroup // pending background compression
+	shifts      serialQueue    // moves rotated files into the numbered backups, see shift
+	filePattern *regexp.Regexp // matches the names of backups
+	maxAge      time.Duration  // remove backups older than maxAge
+	maxTotal    int64          // remove the oldest backups beyond this total size
+	done        chan struct{}  // stops the expiry timer
+	header      HeaderFunc     // written at the start of each new file
+	size        int64          // of the file, including buffered records
+	hooks       hooks          // lifecycle callbacks
 }
 
 const (
@@ -24,103 +39,477 @@ const (
 )
 
 // fileName: log file path: a/b/c.log
-// backupCount: backup files, if backupCount=3: a.log  a.log-2023-12-01  a.log-2023-12-02  a.log-2023-12-03
+// backupCount: backup files, if backupCount=3: a.log  a.log-1  a.log-2  a.log-3
 // fileSize: log file max size, default size 16m
 // async: asynchronous write
+// See NewRotateFileWithOptions for more options.
 func NewRotateFile(fileName string, backupCount int, fileSize int64, async bool) (*RotateFile, error) {
-	if fileSize <= 0 {
-		fileSize = defaultFileSize
-	} else if fileSize < 1024 {
-		return nil, errors.New("file size must be than greater 1024")
+	return NewRotateFileWithOptions(FileOptions{
+		FileName:    fileName,
+		BackupCount: backupCount,
+		MaxSize:     fileSize,
+		Async:       async,
+	})
+}
+
+// NewRotateFileWithOptions creates a RotateFile configured by opts.
+func NewRotateFileWithOptions(opts FileOptions) (*RotateFile, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
 	}
-	filePath := path.Dir(fileName)
-	if err := os.MkdirAll(filePath, 0664); err != nil {
+	if err := os.MkdirAll(path.Dir(opts.FileName), opts.DirMode); err != nil {
 		return nil, err
 	}
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	var file *os.File
+	active := opts.FileName
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s-\d+(\.gz)?$`, regexp.QuoteMeta(path.Base(opts.FileName))))
+	if opts.Symlink {
+		file, active, err = openLinked(opts.FileName, linkLayout, opts.FileMode)
+		pattern = linkedPattern(opts.FileName, linkLayout)
+	} else {
+		file, err = openFile(opts.FileName, opts.FileMode)
+	}
 	if err != nil {
 		return nil, err
 	}
 	rf := &RotateFile{
 		file:        file,
-		fileName:    fileName,
-		maxFileSize: fileSize,
-		backupCount: backupCount,
-		async:       async,
+		fileName:    opts.FileName,
+		active:      active,
+		symlink:     opts.Symlink,
+		fileMode:    opts.FileMode,
+		maxFileSize: opts.MaxSize,
+		backupCount: opts.BackupCount,
+		compress:    opts.Compress,
+		maxTotal:    opts.MaxTotalSize,
+		filePattern: pattern,
+	}
+	rf.header = opts.Header
+	if err := rf.startFileLocked(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	rf.hooks.onRotate = opts.OnRotate
+	rf.hooks.onPrune = opts.OnPrune
+	rf.hooks.onError = opts.OnError
+	if opts.MaxAge > 0 {
+		rf.SetMaxAge(opts.MaxAge)
+	}
+	if opts.WriteBufferSize > 0 {
+		rf.buffer = newWriteBuffer(opts.WriteBufferSize, opts.FlushInterval, rf.flushTimed)
 	}
-	if async {
-		rf.writeChan = make(chan []byte, 10)
-		rf.errorChan = make(chan error, 1)
-		go rf.awaitWrite()
+	rf.syncer = newSyncer(opts, rf.syncTimed)
+	if opts.Async {
+		rf.async = newAsyncWriter(opts, rf.write)
 	}
 	return rf, nil
 }
 
 func (self *RotateFile) Write(p []byte) (n int, err error) {
-	if err = self.rotate(int64(len(p))); err != nil {
-		return
+	return self.WriteLevel(LevelInfo, p)
+}
+
+// WriteLevel implements LevelWriter. In async mode the level of p
+// decides whether it may be dropped, see FileOptions.Overflow; otherwise
+// it is ignored.
+func (self *RotateFile) WriteLevel(level int, p []byte) (n int, err error) {
+	if self.async != nil {
+		return self.async.enqueue(level, p)
 	}
-	if self.async {
-		select {
-		case self.writeChan <- p:
-			return len(p), nil
-		case err = <-self.errorChan:
-			return 0, err
+	return self.write(level, p)
+}
+
+// write rotates the file if needed and writes p, a record at level, to
+// it.
+func (self *RotateFile) write(level int, p []byte) (n int, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err = self.rotate(int64(len(p))); err == nil {
+		n, err = self.buffer.write(self.file, level, p)
+		self.size += int64(n)
+		if err == nil && self.syncer.wrote() {
+			err = self.syncLocked()
 		}
 	}
-	return self.file.Write(p)
+	self.hooks.failed(err)
+	return n, err
 }
 
+// Close writes the records queued in async mode, see
+// FileOptions.CloseTimeout, and closes the file. It returns the first
+// error of those, including a write error not returned by Write yet.
 func (self *RotateFile) Close() error {
-	if self.async {
-		self.async = false
-		close(self.writeChan)
-		close(self.errorChan)
+	var err error
+	if self.async != nil {
+		err = self.async.close()
+	}
+	self.mutex.Lock()
+	if self.done != nil {
+		close(self.done)
+		self.done = nil
+	}
+	self.mutex.Unlock()
+	self.compressing.Wait()
+	self.shifts.wait()
+	self.mutex.Lock()
+	self.buffer.stop()
+	if ferr := self.buffer.flush(self.file); err == nil {
+		err = ferr
+	}
+	if self.syncer.dirty() {
+		if serr := self.file.Sync(); err == nil {
+			err = serr
+		}
+	}
+	self.syncer.synced()
+	if cerr := self.file.Close(); err == nil {
+		err = cerr
+	}
+	self.mutex.Unlock()
+	self.hooks.close()
+	return err
+}
+
+// Flush waits until the records queued in async mode before the call
+// are written, or ctx is done, then writes the buffered records, see
+// FileOptions.WriteBufferSize. It returns ctx.Err() or the first write
+// error not returned by Write yet.
+func (self *RotateFile) Flush(ctx context.Context) error {
+	var err error
+	if self.async != nil {
+		err = self.async.flush(ctx)
 	}
-	return self.file.Close()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if ferr := self.buffer.flush(self.file); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Sync commits the records written so far to disk, including those
+// queued in async mode or buffered, whatever the SyncPolicy.
+func (self *RotateFile) Sync() error {
+	var err error
+	if self.async != nil {
+		err = self.async.flush(context.Background())
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if serr := self.syncLocked(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// syncLocked writes the buffered records and commits the file to disk.
+// self.mutex must be held.
+func (self *RotateFile) syncLocked() error {
+	err := self.buffer.flush(self.file)
+	if err == nil {
+		err = self.file.Sync()
+	}
+	self.syncer.synced()
+	return err
+}
+
+// syncTimed syncs the file for SyncPeriodic.
+func (self *RotateFile) syncTimed() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.hooks.failed(self.syncLocked())
+}
+
+// flushTimed writes the buffered records once they have waited for the
+// flush interval.
+func (self *RotateFile) flushTimed() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.hooks.failed(self.buffer.flush(self.file))
 }
 
 func (self *RotateFile) IsAsync() bool {
-	return self.async
+	return self.async != nil
+}
+
+// Dropped returns the number of records dropped because the async queue
+// was full, see FileOptions.Overflow.
+func (self *RotateFile) Dropped() uint64 {
+	if self.async == nil {
+		return 0
+	}
+	return self.async.droppedCount()
+}
+
+// SetCompress sets whether backups are compressed with gzip after
+// rotation: a.log-1 becomes a.log-1.gz. Compression runs in the
+// background and never delays writes.
+func (self *RotateFile) SetCompress(compress bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.compress = compress
+}
+
+// SetMaxAge sets how long backups are kept, regardless of backupCount.
+// Backups last modified more than maxAge ago are removed after each
+// rotation and, so that idle files are cleaned up too, periodically
+// until Close. maxAge <= 0 keeps backups forever, the default.
+func (self *RotateFile) SetMaxAge(maxAge time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.maxAge = maxAge
+	if maxAge > 0 && self.done == nil {
+		self.done = make(chan struct{})
+		go self.pruneLoop(pruneInterval(maxAge), self.done)
+	}
+}
+
+// SetMaxTotalSize sets a budget for the total size of the log file and
+// its backups. After each rotation the oldest backups are removed until
+// the total is within maxTotal, in addition to the backupCount and MaxAge
+// limits. maxTotal <= 0 sets no budget, the default.
+func (self *RotateFile) SetMaxTotalSize(maxTotal int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.maxTotal = maxTotal
+}
+
+// SetHeader sets a function writing the header of each new file: at
+// every rotation and reopen, and at startup if the file is empty. Files
+// already written to are left alone. See StandardHeader.
+func (self *RotateFile) SetHeader(fn HeaderFunc) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.header = fn
 }
 
+// OnRotate sets a function called after each rotation with the path of
+// the finished file, oldPath, and of the new file, newPath. With
+// compression oldPath is the compressed backup, and fn is called once
+// compression is done. oldPath is not renamed or removed before fn
+// returns, so fn may upload or copy it: the backups are shifted in the
+// background, and the next shift waits for fn.
+//
+// Like OnPrune and OnError, fn is called from a separate goroutine, one
+// event at a time and in order, never while the file is locked, so it
+// may log to this file. A slow fn delays later callbacks and the
+// shifting of backups, not writes. fn must not call Rotate or Close,
+// which wait for it. Close waits for pending callbacks.
+func (self *RotateFile) OnRotate(fn func(oldPath, newPath string)) {
+	self.hooks.setRotate(fn)
+}
+
+// OnPrune sets a function called with the path of each backup file
+// removed by retention. See OnRotate.
+func (self *RotateFile) OnPrune(fn func(path string)) {
+	self.hooks.setPrune(fn)
+}
+
+// OnError sets a function called with the errors of writes, rotations,
+// compressions and removals. Write errors are reported even though Write
+// returns them, since a Logger discards them. See OnRotate.
+func (self *RotateFile) OnError(fn func(err error)) {
+	self.hooks.setError(fn)
+}
+
+func (self *RotateFile) pruneLoop(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// not while backups are being shifted
+			self.shifts.post(self.pruneQueued)
+		case <-done:
+			return
+		}
+	}
+}
+
+// prune removes expired backups, and the oldest backups over the size
+// budget. In symlink mode it also removes the oldest backups beyond
+// backupCount, which otherwise rotation does. self.mutex must be held.
+func (self *RotateFile) prune() {
+	if self.maxAge <= 0 && self.maxTotal <= 0 && !self.symlink {
+		return
+	}
+	backups := listBackups(path.Dir(self.fileName), self.filePattern)
+	backups = without(backups, self.active)
+	backups = removeExpired(backups, self.maxAge, &self.hooks)
+	if self.symlink && len(backups) > self.backupCount {
+		for _, b := range backups[:len(backups)-self.backupCount] {
+			b.remove(&self.hooks)
+		}
+		backups = backups[len(backups)-self.backupCount:]
+	}
+	if self.maxTotal > 0 {
+		removeOverBudget(backups, self.size, self.maxTotal, &self.hooks)
+	}
+}
+
+// pruneQueued prunes from self.shifts.
+func (self *RotateFile) pruneQueued() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.prune()
+}
+
+// rotate rotates the file if writing wn more bytes would exceed its
+// maximum size. self.mutex must be held.
 func (self *RotateFile) rotate(wn int64) (err error) {
 	if self.backupCount < 1 {
 		return
 	}
 
+	if self.size+wn < self.maxFileSize {
+		return
+	}
+	if err = self.statSizeLocked(); err != nil {
+		return err
+	}
+	if self.size+wn < self.maxFileSize {
+		return
+	}
+	return self.rotateLocked()
+}
+
+// statSizeLocked updates the tracked size of the file from Stat, in case
+// the file was truncated behind our back, as logrotate's copytruncate
+// does. self.mutex must be held.
+func (self *RotateFile) statSizeLocked() error {
+	fi, err := self.file.Stat()
+	if err != nil {
+		return err
+	}
+	self.size = fi.Size() + self.buffer.buffered()
+	return nil
+}
+
+// Rotate moves the file to the first backup and starts a new file, as
+// if it had reached its maximum size. It does nothing if backupCount < 1.
+// It returns once the file is the first backup, so it must not be called
+// from OnRotate.
+func (self *RotateFile) Rotate() error {
+	if self.backupCount < 1 {
+		return nil
+	}
 	self.mutex.Lock()
-	defer self.mutex.Unlock()
+	err := self.rotateLocked()
+	self.mutex.Unlock()
+	self.shifts.wait()
+	return err
+}
 
-	fileInfo, err := self.file.Stat()
+// Reopen closes and reopens the file by name, creating it if it was moved
+// or removed, for example by logrotate. See ReopenOnSignal.
+func (self *RotateFile) Reopen() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	// the records written to the old file must be as durable as if it
+	// had been rotated or closed
+	if self.syncer.dirty() {
+		self.hooks.failed(self.syncLocked())
+	} else {
+		self.hooks.failed(self.buffer.flush(self.file))
+	}
+	if self.symlink {
+		file, active, err := openLinked(self.fileName, linkLayout, self.fileMode)
+		if err != nil {
+			return err
+		}
+		_ = self.file.Close()
+		self.file, self.active = file, active
+		return self.startFileLocked()
+	}
+	file, err := openFile(self.fileName, self.fileMode)
 	if err != nil {
 		return err
 	}
+	_ = self.file.Close()
+	self.file = file
+	return self.startFileLocked()
+}
 
-	if fileInfo.Size()+wn < self.maxFileSize {
-		return
+// startFileLocked writes the header of a newly opened file and seeds the
+// size of the file, which is then tracked by write instead of calling
+// Stat on each write. self.mutex must be held.
+func (self *RotateFile) startFileLocked() error {
+	size, err := writeHeader(self.file, self.header)
+	self.size = size
+	return err
+}
+
+// rotateLocked starts a new file. The finished one is renamed to a
+// name of its own, then moved to the first backup by shift on
+// self.shifts, so that writes do not wait for the backups to be
+// compressed or handed to OnRotate. self.mutex must be held.
+func (self *RotateFile) rotateLocked() (err error) {
+	self.hooks.failed(self.buffer.flush(self.file))
+	if self.symlink {
+		return self.rotateLinkedLocked()
 	}
+	_ = self.file.Sync()
+	_ = self.file.Close()
+	rotated := fmt.Sprintf("%s.%d.rotated", self.fileName, time.Now().UnixNano())
+	if err = os.Rename(self.fileName, rotated); err != nil {
+		return err
+	}
+	self.file, err = openFile(self.fileName, self.fileMode)
+	if err != nil {
+		return err
+	}
+	self.hooks.failed(self.startFileLocked())
+	compress := self.compress
+	self.shifts.post(func() { self.shift(rotated, compress) })
+	return nil
+}
 
+// shift shifts the backups and moves rotated, a file finished by
+// rotateLocked, to the first backup, compressing it if compress is set.
+// It runs from self.shifts, one rotation at a time.
+func (self *RotateFile) shift(rotated string, compress bool) {
+	// a backup not yet handed to OnRotate must not be shifted
+	self.hooks.waitRotated()
 	var oldPath, newPath string
+	oldPath = fmt.Sprintf("%s-%d", self.fileName, self.backupCount)
+	removeFile(oldPath, &self.hooks)
+	removeFile(oldPath+compressSuffix, &self.hooks)
 	for i := self.backupCount - 1; i > 0; i-- {
 		oldPath = fmt.Sprintf("%s-%d", self.fileName, i)
 		newPath = fmt.Sprintf("%s-%d", self.fileName, i+1)
 		_ = os.Rename(oldPath, newPath)
+		_ = os.Rename(oldPath+compressSuffix, newPath+compressSuffix)
 	}
-	_ = self.file.Sync()
-	_ = self.file.Close()
 	newPath = self.fileName + "-1"
-	if err = os.Rename(self.fileName, newPath); err != nil {
-		return err
+	if err := os.Rename(rotated, newPath); err != nil {
+		self.hooks.failed(err)
+		return
 	}
-	self.file, err = os.OpenFile(self.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
-	return err
+	if compress {
+		if err := compressFile(newPath); err != nil {
+			self.hooks.failed(err)
+		} else {
+			newPath += compressSuffix
+		}
+	}
+	self.hooks.rotated(newPath, self.fileName)
+	self.pruneQueued()
 }
 
-func (self *RotateFile) awaitWrite() {
-	for data := range self.writeChan {
-		if _, err := self.file.Write(data); err != nil {
-			self.errorChan <- err
-		}
+// rotateLinkedLocked starts a new linked file; the previous one becomes
+// a backup. self.mutex must be held.
+func (self *RotateFile) rotateLinkedLocked() error {
+	file, active, err := createLinked(self.fileName, linkLayout, self.fileMode)
+	if err != nil {
+		return err
 	}
+	_ = self.file.Sync()
+	_ = self.file.Close()
+	oldPath := self.active
+	self.file, self.active = file, active
+	self.hooks.failed(self.startFileLocked())
+	finishBackup(oldPath, self.active, self.compress, &self.compressing, &self.hooks)
+	self.prune()
+	return nil
 }
@@ -0,0 +1,129 @@
+package grlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A Schedule decides when a TimedRotateFile rotates and how its backups
+// are named.
+type Schedule interface {
+	// Next returns the first rotation time strictly after t, in t's location.
+	Next(t time.Time) time.Time
+	// Layout returns the time layout of the backup name suffix,
+	// a.log-<layout>. It must contain only numeric elements.
+	Layout() string
+}
+
+// Predefined schedules. Daily is the default of TimedRotateFile.
+var (
+	Hourly  Schedule = Every(time.Hour)
+	Daily   Schedule = Every(24 * time.Hour)
+	Weekly  Schedule = weekly{}  // every Monday at 00:00
+	Monthly Schedule = monthly{} // the first day of every month at 00:00
+)
+
+// Every returns a schedule that rotates every d, rounded down to whole
+// seconds. Intervals up to a day are aligned to midnight: Every(15 *
+// time.Minute) rotates at 00:00, 00:15, 00:30 and so on by the wall
+// clock, and a period that does not divide the day is cut short at
+// midnight. Longer intervals are aligned to the zero time.
+func Every(d time.Duration) Schedule {
+	d = d.Truncate(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+	return interval(d)
+}
+
+type interval time.Duration
+
+func (s interval) Next(t time.Time) time.Time {
+	d := time.Duration(s)
+	if d > 24*time.Hour {
+		return t.Truncate(d).Add(d)
+	}
+	y, m, day := t.Date()
+	hour, min, sec := t.Clock()
+	step := int(d / time.Second)
+	next := (hour*3600+min*60+sec)/step*step + step
+	if next >= 24*3600 {
+		return time.Date(y, m, day+1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, day, 0, 0, next, 0, t.Location())
+}
+
+func (s interval) Layout() string {
+	d := time.Duration(s)
+	switch {
+	case d%(24*time.Hour) == 0:
+		return "2006-01-02"
+	case d%time.Hour == 0:
+		return "2006-01-02T15"
+	case d%time.Minute == 0:
+		return "2006-01-02T1504"
+	default:
+		return "2006-01-02T150405"
+	}
+}
+
+type weekly struct{}
+
+func (weekly) Next(t time.Time) time.Time {
+	y, m, d := t.Date()
+	days := (8 - int(t.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	return time.Date(y, m, d+days, 0, 0, 0, 0, t.Location())
+}
+
+func (weekly) Layout() string { return "2006-01-02" }
+
+type monthly struct{}
+
+func (monthly) Next(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+func (monthly) Layout() string { return "2006-01" }
+
+// backupPattern returns the pattern matching the names of the backups of
+// base named with layout, including the -N suffix added on collisions and
+// the compression suffix.
+func backupPattern(base string, layout string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `-` + digitsPattern(layout) + `(-\d+)?(\.gz)?$`)
+}
+
+// checkLayout returns an error if the names of backups made with layout
+// would not be matched by their pattern, so that retention would never
+// find them: layout must contain only numeric elements.
+func checkLayout(layout string) error {
+	pattern := regexp.MustCompile(`^` + digitsPattern(layout) + `$`)
+	for _, t := range []time.Time{
+		time.Date(2024, 11, 23, 19, 58, 47, 123456789, time.UTC),
+		time.Date(2024, 11, 23, 19, 58, 47, 123456789, time.FixedZone("", 5*3600+30*60)),
+	} {
+		if !pattern.MatchString(t.Format(layout)) {
+			return fmt.Errorf("backup layout %q must contain only numeric elements", layout)
+		}
+	}
+	return nil
+}
+
+// digitsPattern returns a pattern matching the times formatted with
+// layout, which must contain only numeric elements.
+func digitsPattern(layout string) string {
+	var b strings.Builder
+	for _, r := range regexp.QuoteMeta(layout) {
+		if r >= '0' && r <= '9' {
+			b.WriteString(`\d`)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package grlog
+
+import "os"
+
+// reopenSignals are the signals ReopenOnSignal listens for by default.
+// There are none outside Unix; pass the signals to ReopenOnSignal.
+var reopenSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package grlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals are the signals ReopenOnSignal listens for by default.
+var reopenSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}
@@ -0,0 +1,122 @@
+package grlog
+
+import (
+	"io"
+	"sync"
+)
+
+// A Sink receives the complete records of a logger in place of its
+// formatter and writer, see Logger.SetSink. A Logger serializes calls
+// to its Sink; Emit must not retain r after returning.
+type Sink interface {
+	Emit(r *Record) error
+}
+
+// A LevelWriter is an io.Writer that also accepts the level of each
+// formatted record, for example to decide what to drop when it falls
+// behind. Loggers and WriterSinks write to their output with WriteLevel
+// when it implements LevelWriter.
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(level int, p []byte) (n int, err error)
+}
+
+// writeLevel writes p, the formatted record r, to w.
+func writeLevel(w io.Writer, r *Record, p []byte) (int, error) {
+	if lw, ok := w.(LevelWriter); ok {
+		return lw.WriteLevel(recordLevel(r), p)
+	}
+	return w.Write(p)
+}
+
+// recordLevel returns the level used to route r. Records without a
+// level, such as those of Print, are routed as LevelInfo.
+func recordLevel(r *Record) int {
+	if r.HasLevel {
+		return r.Level
+	}
+	return LevelInfo
+}
+
+// WriterSink is a Sink that formats records and writes them to an
+// io.Writer. It is safe to share a WriterSink between loggers.
+type WriterSink struct {
+	mu        sync.Mutex
+	out       io.Writer
+	level     int
+	formatter Formatter
+	buf       []byte
+}
+
+// NewWriterSink returns a sink that writes the records at level or more
+// severe to w, laid out by f. A nil f selects the formatter from the
+// flags of each record, like a Logger without a formatter.
+func NewWriterSink(w io.Writer, level int, f Formatter) *WriterSink {
+	return &WriterSink{out: w, level: level, formatter: f}
+}
+
+// Emit implements Sink.
+func (s *WriterSink) Emit(r *Record) error {
+	if recordLevel(r) > s.level {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.formatter
+	if f == nil {
+		f = defaultFormatter(r.Flag)
+	}
+	s.buf = s.buf[:0]
+	f.Format(&s.buf, r)
+	_, err := writeLevel(s.out, r, s.buf)
+	return err
+}
+
+// Writer returns the destination of the sink.
+func (s *WriterSink) Writer() io.Writer {
+	return s.out
+}
+
+// LevelSink returns a sink that passes only the records at level or more
+// severe on to s.
+func LevelSink(s Sink, level int) Sink {
+	return levelSink{s: s, level: level}
+}
+
+type levelSink struct {
+	s     Sink
+	level int
+}
+
+func (s levelSink) Emit(r *Record) error {
+	if recordLevel(r) > s.level {
+		return nil
+	}
+	return s.s.Emit(r)
+}
+
+// Tee returns a sink that hands every record to each of sinks in turn.
+// All sinks see the same record, so the time, caller and fields are
+// gathered only once. Emit returns the first error encountered.
+//
+//	log.SetLevel(grlog.LevelDebug)
+//	log.SetSink(grlog.Tee(
+//		grlog.NewWriterSink(rotateFile, grlog.LevelDebug, grlog.JSONFormatter{}),
+//		grlog.NewWriterSink(os.Stderr, grlog.LevelWarn, nil),
+//		grlog.NewWriterSink(errorFile, grlog.LevelError, nil),
+//	))
+func Tee(sinks ...Sink) Sink {
+	return teeSink(append([]Sink(nil), sinks...))
+}
+
+type teeSink []Sink
+
+func (t teeSink) Emit(r *Record) error {
+	var first error
+	for _, s := range t {
+		if err := s.Emit(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
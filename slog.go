@@ -0,0 +1,162 @@
+//go:build go1.21
+
+package grlog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// NewSlogHandler returns a slog.Handler that writes slog records through l,
+// so libraries logging with log/slog share the logger's level, formatter
+// and writer. slog levels are mapped to the nearest grlog level, and
+// attributes become fields; keys inside groups are joined with dots.
+// Fields from the registered context extractors are added as well.
+func NewSlogHandler(l *Logger) slog.Handler {
+	return &slogHandler{l: l}
+}
+
+type slogHandler struct {
+	l      *Logger
+	groups string // open groups, each followed by a dot
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, sr slog.Record) error {
+	r := Record{
+		Time:     sr.Time,
+		Level:    fromSlogLevel(sr.Level),
+		HasLevel: true,
+		Message:  sr.Message,
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if sr.NumAttrs() > 0 {
+		r.Fields = make([]Field, 0, sr.NumAttrs())
+		sr.Attrs(func(a slog.Attr) bool {
+			r.Fields = appendAttr(r.Fields, h.groups, a)
+			return true
+		})
+	}
+	r.Fields = append(r.Fields, contextFields(ctx)...)
+	if h.l.Flags()&(FlagSFile|FlagLFile) != 0 {
+		r.File, r.Line = "???", 0
+		if sr.PC != 0 {
+			f, _ := runtime.CallersFrames([]uintptr{sr.PC}).Next()
+			r.File, r.Line = f.File, f.Line
+		}
+	}
+	h.l.lock().Lock()
+	defer h.l.lock().Unlock()
+	return h.l.emitLocked(&r)
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var fields []Field
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.groups, a)
+	}
+	if len(fields) == 0 {
+		return h
+	}
+	kv := make([]any, len(fields))
+	for i, f := range fields {
+		kv[i] = f
+	}
+	return &slogHandler{l: h.l.With(kv...), groups: h.groups}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{l: h.l, groups: h.groups + name + "."}
+}
+
+// appendAttr appends a as fields, flattening groups into dotted keys.
+func appendAttr(fields []Field, groups string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, groups, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: groups + a.Key, Value: a.Value.Any()})
+}
+
+func fromSlogLevel(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return LevelError
+	case level >= slog.LevelWarn:
+		return LevelWarn
+	case level >= slog.LevelInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
+
+func toSlogLevel(level int) slog.Level {
+	switch {
+	case level <= LevelError:
+		return slog.LevelError
+	case level <= LevelWarn:
+		return slog.LevelWarn
+	case level <= LevelInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// NewSlogSink returns a Sink that hands a logger's records to h:
+//
+//	log.SetSink(grlog.NewSlogSink(slog.NewJSONHandler(w, nil)))
+//
+// Records without a level are passed at slog.LevelInfo. The logger's
+// name, if any, is added as the attribute "logger" and fields become
+// attributes. The logger's prefix and formatter are not used.
+func NewSlogSink(h slog.Handler) Sink {
+	return slogSink{h: h}
+}
+
+type slogSink struct {
+	h slog.Handler
+}
+
+func (s slogSink) Emit(r *Record) error {
+	level := slog.LevelInfo
+	if r.HasLevel {
+		level = toSlogLevel(r.Level)
+	}
+	ctx := context.Background()
+	if !s.h.Enabled(ctx, level) {
+		return nil
+	}
+	msg := r.Message
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	sr := slog.NewRecord(r.Time, level, msg, 0)
+	if r.Name != "" {
+		sr.AddAttrs(slog.String("logger", r.Name))
+	}
+	for _, f := range r.Fields {
+		sr.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	return s.h.Handle(ctx, sr)
+}
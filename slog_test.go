@@ -0,0 +1,34 @@
+//go:build go1.21
+
+package grlog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(buf, "", FlagLevel, LevelInfo)
+	sl := slog.New(NewSlogHandler(log)).With("svc", "api").WithGroup("req")
+	sl.Debug("hidden")
+	sl.Warn("slow", "ms", 120, slog.Group("user", "id", 7))
+	want := "WARN slow svc=api req.ms=120 req.user.id=7\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSlogSink(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(nil, "", FlagStd, LevelDebug)
+	log.SetSink(NewSlogSink(slog.NewTextHandler(buf, nil)))
+	log.Debug("hidden by handler")
+	log.Named("db").Errorw("query failed", "table", "orders")
+	got := buf.String()
+	if strings.Contains(got, "hidden") || !strings.Contains(got, `level=ERROR msg="query failed" logger=db table=orders`) {
+		t.Errorf("got %q", got)
+	}
+}
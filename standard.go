@@ -1,10 +1,12 @@
 package grlog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"sync/atomic"
+	"time"
 )
 
 var std = New(os.Stderr, "", FlagStd, LevelInfo)
@@ -51,6 +53,34 @@ func SetLevel(level int) {
 	std.SetLevel(level)
 }
 
+// With returns a child of the standard logger that adds the given
+// fields to every record. See Logger.With.
+func With(keysAndValues ...any) *Logger {
+	return std.With(keysAndValues...)
+}
+
+// Named returns a named child of the standard logger. See Logger.Named.
+func Named(name string) *Logger {
+	return std.Named(name)
+}
+
+// TimeLayout returns the time layout of the standard logger.
+func TimeLayout() string {
+	return std.TimeLayout()
+}
+
+// SetTimeLayout sets the time layout of the standard logger.
+// See Logger.SetTimeLayout.
+func SetTimeLayout(layout string) {
+	std.SetTimeLayout(layout)
+}
+
+// SetClock sets the time source of the standard logger.
+// See Logger.SetClock.
+func SetClock(clock func() time.Time) {
+	std.SetClock(clock)
+}
+
 // Writer returns the output destination for the standard logger.
 func Writer() io.Writer {
 	return std.Writer()
@@ -139,12 +169,12 @@ func Error(format string, v ...any) {
 	if atomic.LoadInt32(&std.isDiscard) != 0 {
 		return
 	}
-	std.mu.Lock()
+	std.lock().Lock()
 	if std.level < LevelError {
-		std.mu.Unlock()
+		std.lock().Unlock()
 		return
 	}
-	std.mu.Unlock()
+	std.lock().Unlock()
 	std.Output(2, fmt.Sprintf(format, v...), LevelError)
 }
 
@@ -152,12 +182,12 @@ func Warn(format string, v ...any) {
 	if atomic.LoadInt32(&std.isDiscard) != 0 {
 		return
 	}
-	std.mu.Lock()
+	std.lock().Lock()
 	if std.level < LevelWarn {
-		std.mu.Unlock()
+		std.lock().Unlock()
 		return
 	}
-	std.mu.Unlock()
+	std.lock().Unlock()
 	std.Output(2, fmt.Sprintf(format, v...), LevelWarn)
 }
 
@@ -165,12 +195,12 @@ func Info(format string, v ...any) {
 	if atomic.LoadInt32(&std.isDiscard) != 0 {
 		return
 	}
-	std.mu.Lock()
+	std.lock().Lock()
 	if std.level < LevelInfo {
-		std.mu.Unlock()
+		std.lock().Unlock()
 		return
 	}
-	std.mu.Unlock()
+	std.lock().Unlock()
 	std.Output(2, fmt.Sprintf(format, v...), LevelInfo)
 }
 
@@ -178,12 +208,12 @@ func Debug(format string, v ...any) {
 	if atomic.LoadInt32(&std.isDiscard) != 0 {
 		return
 	}
-	std.mu.Lock()
+	std.lock().Lock()
 	if std.level < LevelDebug {
-		std.mu.Unlock()
+		std.lock().Unlock()
 		return
 	}
-	std.mu.Unlock()
+	std.lock().Unlock()
 	std.Output(2, fmt.Sprintf(format, v...), LevelDebug)
 }
 
@@ -193,3 +223,98 @@ func Log(level int, format string, v ...any) {
 	}
 	std.Output(2, fmt.Sprintf(format, v...), level)
 }
+
+// Errorw logs a message at LevelError with structured fields
+// on the standard logger.
+func Errorw(msg string, keysAndValues ...any) {
+	if !std.enabled(LevelError) {
+		return
+	}
+	std.output(2, msg, fieldsOf(keysAndValues), LevelError)
+}
+
+// Warnw logs a message at LevelWarn with structured fields
+// on the standard logger.
+func Warnw(msg string, keysAndValues ...any) {
+	if !std.enabled(LevelWarn) {
+		return
+	}
+	std.output(2, msg, fieldsOf(keysAndValues), LevelWarn)
+}
+
+// Infow logs a message at LevelInfo with structured fields
+// on the standard logger.
+func Infow(msg string, keysAndValues ...any) {
+	if !std.enabled(LevelInfo) {
+		return
+	}
+	std.output(2, msg, fieldsOf(keysAndValues), LevelInfo)
+}
+
+// Debugw logs a message at LevelDebug with structured fields
+// on the standard logger.
+func Debugw(msg string, keysAndValues ...any) {
+	if !std.enabled(LevelDebug) {
+		return
+	}
+	std.output(2, msg, fieldsOf(keysAndValues), LevelDebug)
+}
+
+// Logw logs a message at the given level with structured fields
+// on the standard logger.
+func Logw(level int, msg string, keysAndValues ...any) {
+	if atomic.LoadInt32(&std.isDiscard) != 0 {
+		return
+	}
+	std.output(2, msg, fieldsOf(keysAndValues), level)
+}
+
+// ErrorCtx logs at LevelError on the logger carried by ctx, or the
+// standard logger, adding the fields extracted from ctx.
+func ErrorCtx(ctx context.Context, format string, v ...any) {
+	l := FromContext(ctx)
+	if !l.enabled(LevelError) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelError)
+}
+
+// WarnCtx logs at LevelWarn on the logger carried by ctx, or the
+// standard logger, adding the fields extracted from ctx.
+func WarnCtx(ctx context.Context, format string, v ...any) {
+	l := FromContext(ctx)
+	if !l.enabled(LevelWarn) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelWarn)
+}
+
+// InfoCtx logs at LevelInfo on the logger carried by ctx, or the
+// standard logger, adding the fields extracted from ctx.
+func InfoCtx(ctx context.Context, format string, v ...any) {
+	l := FromContext(ctx)
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelInfo)
+}
+
+// DebugCtx logs at LevelDebug on the logger carried by ctx, or the
+// standard logger, adding the fields extracted from ctx.
+func DebugCtx(ctx context.Context, format string, v ...any) {
+	l := FromContext(ctx)
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), LevelDebug)
+}
+
+// LogCtx logs at the given level on the logger carried by ctx, or the
+// standard logger, adding the fields extracted from ctx.
+func LogCtx(ctx context.Context, level int, format string, v ...any) {
+	l := FromContext(ctx)
+	if atomic.LoadInt32(&l.isDiscard) != 0 {
+		return
+	}
+	l.output(2, fmt.Sprintf(format, v...), contextFields(ctx), level)
+}
@@ -0,0 +1,144 @@
+package grlog
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// linkLayout is the time layout of the files a RotateFile writes in
+// symlink mode.
+const linkLayout = "20060102T150405"
+
+// splitExt splits the base name of fileName into a stem and an extension:
+// a/app.log gives "app" and ".log".
+func splitExt(fileName string) (stem string, ext string) {
+	base := path.Base(fileName)
+	ext = path.Ext(base)
+	if ext == base { // a dot file such as .log
+		ext = ""
+	}
+	return strings.TrimSuffix(base, ext), ext
+}
+
+// linkedName returns an unused name, next to fileName, for a file
+// created at t: a/app.log gives a/app-20240101T1300.log, or
+// a/app-20240101T1300-1.log if that exists.
+func linkedName(fileName string, t time.Time, layout string) (string, error) {
+	stem, ext := splitExt(fileName)
+	prefix := path.Join(path.Dir(fileName), stem+"-"+t.Format(layout))
+	name := prefix + ext
+	for i := 1; ; i++ {
+		ok, err := exists(name)
+		if err == nil && !ok {
+			ok, err = exists(name + compressSuffix)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d%s", prefix, i, ext)
+	}
+}
+
+// linkedPattern returns the pattern matching the names returned by
+// linkedName for fileName and layout, compressed or not.
+func linkedPattern(fileName string, layout string) *regexp.Regexp {
+	stem, ext := splitExt(fileName)
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(stem) + `-` + digitsPattern(layout) +
+		`(-\d+)?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+}
+
+// createLinked creates a new uniquely named file for the symlink
+// fileName and points the link at it. It returns the file and its path.
+func createLinked(fileName string, layout string, mode os.FileMode) (*os.File, string, error) {
+	name, err := linkedName(fileName, time.Now(), layout)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := openFile(name, mode)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := link(fileName, name); err != nil {
+		_ = file.Close()
+		return nil, "", err
+	}
+	return file, name, nil
+}
+
+// openLinked opens the file the symlink fileName points at. If fileName
+// does not exist a new linked file is created. A regular file at
+// fileName is renamed to a linked name and linked, so that switching to
+// symlink mode keeps appending to it.
+func openLinked(fileName string, layout string, mode os.FileMode) (*os.File, string, error) {
+	fi, err := os.Lstat(fileName)
+	if os.IsNotExist(err) {
+		return createLinked(fileName, layout, mode)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fileName)
+		if err != nil {
+			return nil, "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(fileName), target)
+		}
+		if ok, err := exists(target); err != nil {
+			return nil, "", err
+		} else if !ok {
+			return createLinked(fileName, layout, mode)
+		}
+		file, err := openFile(target, mode)
+		return file, target, err
+	}
+	name, err := linkedName(fileName, fi.ModTime(), layout)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Rename(fileName, name); err != nil {
+		return nil, "", err
+	}
+	file, err := openFile(name, mode)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := link(fileName, name); err != nil {
+		_ = file.Close()
+		return nil, "", err
+	}
+	return file, name, nil
+}
+
+// link atomically replaces name with a symlink to target. The link is
+// relative, so the directory can be moved.
+func link(name string, target string) error {
+	tmp := name + ".link.tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(path.Base(target), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// without returns backups without the one at name.
+func without(backups []backup, name string) []backup {
+	for i, b := range backups {
+		if b.path == name {
+			return append(backups[:i], backups[i+1:]...)
+		}
+	}
+	return backups
+}
@@ -1,11 +1,12 @@
 package grlog
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,160 +14,527 @@ import (
 type TimedRotateFile struct {
 	file        *os.File
 	fileName    string
+	fileMode    os.FileMode
+	active      string // path of the file being written, see FileOptions.Symlink
+	symlink     bool
 	maxFileSize int64
 	backupCount int
 	mutex       sync.Mutex
-	async       bool //async write
-	writeChan   chan []byte
-	errorChan   chan error
+	async       *asyncWriter // nil unless writing asynchronously
+	buffer      *writeBuffer // nil unless buffering writes
+	syncer      *syncer      // nil for SyncNever
 	filePattern *regexp.Regexp
 	rotateTime  time.Time
+	lastWrite   time.Time      // of the last record, names the backup
+	schedule    Schedule       // when to rotate, Daily by default
+	layout      string         // time layout of backup names
+	compress    bool           // gzip backups after rotation
+	compressing sync.WaitGroup // pending background compression
+	maxAge      time.Duration  // remove backups older than maxAge
+	maxTotal    int64          // remove the oldest backups beyond this total size
+	done        chan struct{}  // stops the expiry timer
+	header      HeaderFunc     // written at the start of each new file
+	size        int64          // of the file, including buffered records
+	hooks       hooks          // lifecycle callbacks
 }
 
-// backup yesterday's files at 00:00 every day
+// backup yesterday's files at 00:00 every day, see SetSchedule for other intervals
 // fileName: log file path: a/b/c.log
 // backupCount: backup files, if backupCount=3: a.log  a.log-2023-12-01  a.log-2023-12-02  a.log-2023-12-03
 // fileSize: log file max size, default size 16m
 // async: asynchronous write
+// See NewTimedRotateFileWithOptions for more options.
 func NewTimedRotateFile(fileName string, backupCount int, fileSize int64, async bool) (*TimedRotateFile, error) {
-	if fileSize <= 0 {
-		fileSize = defaultFileSize
-	} else if fileSize < 1024 {
-		return nil, errors.New("file size must be than greater 1024")
+	return NewTimedRotateFileWithOptions(FileOptions{
+		FileName:    fileName,
+		BackupCount: backupCount,
+		MaxSize:     fileSize,
+		Async:       async,
+	})
+}
+
+// NewTimedRotateFileWithOptions creates a TimedRotateFile configured by opts.
+func NewTimedRotateFileWithOptions(opts FileOptions) (*TimedRotateFile, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
 	}
-	filePath := path.Dir(fileName)
-	if err := os.MkdirAll(filePath, 0664); err != nil {
+	if err := os.MkdirAll(path.Dir(opts.FileName), opts.DirMode); err != nil {
 		return nil, err
 	}
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	var file *os.File
+	active := opts.FileName
+	if opts.Symlink {
+		file, active, err = openLinked(opts.FileName, linkedLayout(opts.BackupLayout), opts.FileMode)
+	} else {
+		file, err = openFile(opts.FileName, opts.FileMode)
+	}
 	if err != nil {
 		return nil, err
 	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
 
 	rf := &TimedRotateFile{
 		file:        file,
-		fileName:    fileName,
-		maxFileSize: fileSize,
-		backupCount: backupCount,
-		async:       async,
-		filePattern: regexp.MustCompile(fmt.Sprintf("^%s-\\d{4}-\\d{2}-\\d{2}$", fileName)),
+		fileName:    opts.FileName,
+		fileMode:    opts.FileMode,
+		active:      active,
+		symlink:     opts.Symlink,
+		maxFileSize: opts.MaxSize,
+		backupCount: opts.BackupCount,
+		schedule:    opts.Schedule,
+		layout:      opts.BackupLayout,
+		compress:    opts.Compress,
+		maxTotal:    opts.MaxTotalSize,
 	}
-	stat, _ := os.Stat(fileName)
+	rf.filePattern = rf.backupPattern()
 	rf.setRotateTime(stat.ModTime())
-	if async {
-		rf.writeChan = make(chan []byte, 10)
-		rf.errorChan = make(chan error, 1)
-		go rf.awaitWrite()
+	rf.header = opts.Header
+	if err := rf.startFileLocked(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	rf.hooks.onRotate = opts.OnRotate
+	rf.hooks.onPrune = opts.OnPrune
+	rf.hooks.onError = opts.OnError
+	if opts.MaxAge > 0 {
+		rf.SetMaxAge(opts.MaxAge)
+	}
+	if opts.WriteBufferSize > 0 {
+		rf.buffer = newWriteBuffer(opts.WriteBufferSize, opts.FlushInterval, rf.flushTimed)
+	}
+	rf.syncer = newSyncer(opts, rf.syncTimed)
+	if opts.Async {
+		rf.async = newAsyncWriter(opts, rf.write)
 	}
 	return rf, nil
 }
 
 func (self *TimedRotateFile) Write(p []byte) (n int, err error) {
-	if err = self.rotate(int64(len(p))); err != nil {
-		panic(err)
-		return
+	return self.WriteLevel(LevelInfo, p)
+}
+
+// WriteLevel implements LevelWriter. In async mode the level of p
+// decides whether it may be dropped, see FileOptions.Overflow; otherwise
+// it is ignored.
+func (self *TimedRotateFile) WriteLevel(level int, p []byte) (n int, err error) {
+	if self.async != nil {
+		return self.async.enqueue(level, p)
 	}
-	if self.async {
-		select {
-		case self.writeChan <- p:
-			return len(p), nil
-		case err = <-self.errorChan:
-			return 0, err
+	return self.write(level, p)
+}
+
+// write rotates the file if needed and writes p, a record at level, to
+// it.
+func (self *TimedRotateFile) write(level int, p []byte) (n int, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err = self.rotate(int64(len(p))); err == nil {
+		n, err = self.buffer.write(self.file, level, p)
+		self.size += int64(n)
+		if n > 0 {
+			self.lastWrite = time.Now()
+		}
+		if err == nil && self.syncer.wrote() {
+			err = self.syncLocked()
 		}
 	}
-	return self.file.Write(p)
+	self.hooks.failed(err)
+	return n, err
 }
 
+// Close writes the records queued in async mode, see
+// FileOptions.CloseTimeout, and closes the file. It returns the first
+// error of those, including a write error not returned by Write yet.
 func (self *TimedRotateFile) Close() error {
-	if self.async {
-		self.async = false
-		close(self.writeChan)
-		close(self.errorChan)
+	var err error
+	if self.async != nil {
+		err = self.async.close()
+	}
+	self.mutex.Lock()
+	if self.done != nil {
+		close(self.done)
+		self.done = nil
+	}
+	self.mutex.Unlock()
+	self.compressing.Wait()
+	self.mutex.Lock()
+	self.buffer.stop()
+	if ferr := self.buffer.flush(self.file); err == nil {
+		err = ferr
+	}
+	if self.syncer.dirty() {
+		if serr := self.file.Sync(); err == nil {
+			err = serr
+		}
+	}
+	self.syncer.synced()
+	if cerr := self.file.Close(); err == nil {
+		err = cerr
+	}
+	self.mutex.Unlock()
+	self.hooks.close()
+	return err
+}
+
+// Flush waits until the records queued in async mode before the call
+// are written, or ctx is done, then writes the buffered records, see
+// FileOptions.WriteBufferSize. It returns ctx.Err() or the first write
+// error not returned by Write yet.
+func (self *TimedRotateFile) Flush(ctx context.Context) error {
+	var err error
+	if self.async != nil {
+		err = self.async.flush(ctx)
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if ferr := self.buffer.flush(self.file); err == nil {
+		err = ferr
 	}
-	return self.file.Close()
+	return err
+}
+
+// Sync commits the records written so far to disk, including those
+// queued in async mode or buffered, whatever the SyncPolicy.
+func (self *TimedRotateFile) Sync() error {
+	var err error
+	if self.async != nil {
+		err = self.async.flush(context.Background())
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if serr := self.syncLocked(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// syncLocked writes the buffered records and commits the file to disk.
+// self.mutex must be held.
+func (self *TimedRotateFile) syncLocked() error {
+	err := self.buffer.flush(self.file)
+	if err == nil {
+		err = self.file.Sync()
+	}
+	self.syncer.synced()
+	return err
+}
+
+// syncTimed syncs the file for SyncPeriodic.
+func (self *TimedRotateFile) syncTimed() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.hooks.failed(self.syncLocked())
+}
+
+// flushTimed writes the buffered records once they have waited for the
+// flush interval.
+func (self *TimedRotateFile) flushTimed() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.hooks.failed(self.buffer.flush(self.file))
 }
 
 func (self *TimedRotateFile) IsAsync() bool {
-	return self.async
+	return self.async != nil
+}
+
+// Dropped returns the number of records dropped because the async queue
+// was full, see FileOptions.Overflow.
+func (self *TimedRotateFile) Dropped() uint64 {
+	if self.async == nil {
+		return 0
+	}
+	return self.async.droppedCount()
+}
+
+// SetCompress sets whether backups are compressed with gzip after
+// rotation: a.log-2023-12-01 becomes a.log-2023-12-01.gz. Compression
+// runs in the background and does not block writes.
+func (self *TimedRotateFile) SetCompress(compress bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.compress = compress
+}
+
+// SetMaxAge sets how long backups are kept, regardless of backupCount.
+// Backups last modified more than maxAge ago are removed after each
+// rotation and, so that idle files are cleaned up too, periodically
+// until Close. maxAge <= 0 keeps backups forever, the default.
+func (self *TimedRotateFile) SetMaxAge(maxAge time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.maxAge = maxAge
+	if maxAge > 0 && self.done == nil {
+		self.done = make(chan struct{})
+		go self.pruneLoop(pruneInterval(maxAge), self.done)
+	}
+}
+
+// SetMaxTotalSize sets a budget for the total size of the log file and
+// its backups. After each rotation the oldest backups are removed until
+// the total is within maxTotal, in addition to the backupCount and MaxAge
+// limits. maxTotal <= 0 sets no budget, the default.
+func (self *TimedRotateFile) SetMaxTotalSize(maxTotal int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.maxTotal = maxTotal
+}
+
+// SetHeader sets a function writing the header of each new file: at
+// every rotation and reopen, and at startup if the file is empty. Files
+// already written to are left alone. See StandardHeader.
+func (self *TimedRotateFile) SetHeader(fn HeaderFunc) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.header = fn
+}
+
+// OnRotate sets a function called after each rotation with the path of
+// the finished file, oldPath, and of the new file, newPath. With
+// compression oldPath is the compressed backup, and fn is called once
+// compression is done.
+//
+// Like OnPrune and OnError, fn is called from a separate goroutine, one
+// event at a time and in order, never while the file is locked; a slow
+// fn delays only later callbacks, not writes. Close waits for pending
+// callbacks.
+func (self *TimedRotateFile) OnRotate(fn func(oldPath, newPath string)) {
+	self.hooks.setRotate(fn)
+}
+
+// OnPrune sets a function called with the path of each backup file
+// removed by retention. See OnRotate.
+func (self *TimedRotateFile) OnPrune(fn func(path string)) {
+	self.hooks.setPrune(fn)
 }
 
-func (self *TimedRotateFile) awaitWrite() {
-	for data := range self.writeChan {
-		if _, err := self.file.Write(data); err != nil {
-			self.errorChan <- err
+// OnError sets a function called with the errors of writes, rotations,
+// compressions and removals. Write errors are reported even though Write
+// returns them, since a Logger discards them. See OnRotate.
+func (self *TimedRotateFile) OnError(fn func(err error)) {
+	self.hooks.setError(fn)
+}
+
+func (self *TimedRotateFile) pruneLoop(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			self.mutex.Lock()
+			self.prune()
+			self.mutex.Unlock()
+		case <-done:
+			return
 		}
 	}
 }
 
 func (self *TimedRotateFile) setRotateTime(t time.Time) {
-	y, m, d := t.Date()
-	self.rotateTime = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	self.rotateTime = self.schedule.Next(t)
 }
 
+// SetSchedule sets when the file rotates, Daily by default, for example
+// Hourly, Every(15 * time.Minute) or Monthly. Backups are named after
+// the schedule's layout, such as a.log-2024-01-01T13 for Hourly; backups
+// named after a previous schedule are no longer counted or pruned. It
+// returns an error if the layout has non-numeric elements.
+func (self *TimedRotateFile) SetSchedule(schedule Schedule) error {
+	layout := schedule.Layout()
+	if err := checkLayout(layout); err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.schedule = schedule
+	self.layout = layout
+	self.filePattern = self.backupPattern()
+	self.setRotateTime(self.lastWrite)
+	return nil
+}
+
+// backupPattern returns the pattern matching the names of backups.
+func (self *TimedRotateFile) backupPattern() *regexp.Regexp {
+	if self.symlink {
+		return linkedPattern(self.fileName, linkedLayout(self.layout))
+	}
+	return backupPattern(path.Base(self.fileName), self.layout)
+}
+
+// linkedLayout returns the time layout of the files written in symlink
+// mode: layout without dashes.
+func linkedLayout(layout string) string {
+	return strings.ReplaceAll(layout, "-", "")
+}
+
+// rotate rotates the file if writing wn more bytes would exceed its
+// maximum size, or the rotation time has come. self.mutex must be held.
 func (self *TimedRotateFile) rotate(wn int64) (err error) {
 	if self.backupCount < 1 {
 		return
 	}
 
+	if time.Now().Before(self.rotateTime) {
+		if self.size+wn < self.maxFileSize {
+			return nil
+		}
+		if err = self.statSizeLocked(); err != nil {
+			return err
+		}
+		if self.size+wn < self.maxFileSize {
+			return nil
+		}
+	}
+	return self.rotateLocked()
+}
+
+// statSizeLocked updates the tracked size of the file from Stat, in case
+// the file was truncated behind our back, as logrotate's copytruncate
+// does. self.mutex must be held.
+func (self *TimedRotateFile) statSizeLocked() error {
+	fi, err := self.file.Stat()
+	if err != nil {
+		return err
+	}
+	self.size = fi.Size() + self.buffer.buffered()
+	return nil
+}
+
+// Rotate moves the file to a backup named after its modification time
+// and starts a new file, as if the rotation time had come. It does
+// nothing if backupCount < 1.
+func (self *TimedRotateFile) Rotate() error {
+	if self.backupCount < 1 {
+		return nil
+	}
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
+	return self.rotateLocked()
+}
 
-	fileInfo, err := self.file.Stat()
+// Reopen closes and reopens the file by name, creating it if it was moved
+// or removed, for example by logrotate. See ReopenOnSignal.
+func (self *TimedRotateFile) Reopen() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	// the records written to the old file must be as durable as if it
+	// had been rotated or closed
+	if self.syncer.dirty() {
+		self.hooks.failed(self.syncLocked())
+	} else {
+		self.hooks.failed(self.buffer.flush(self.file))
+	}
+	if self.symlink {
+		file, active, err := openLinked(self.fileName, linkedLayout(self.layout), self.fileMode)
+		if err != nil {
+			return err
+		}
+		_ = self.file.Close()
+		self.file, self.active = file, active
+		return self.startFileLocked()
+	}
+	file, err := openFile(self.fileName, self.fileMode)
 	if err != nil {
 		return err
 	}
-	now := time.Now()
-	if now.Before(self.rotateTime) {
-		if fileInfo.Size()+wn < self.maxFileSize {
-			return nil
-		}
+	_ = self.file.Close()
+	self.file = file
+	return self.startFileLocked()
+}
+
+// startFileLocked writes the header of a newly opened file and seeds the
+// size and last write time of the file, which are then tracked by write
+// instead of calling Stat on each write. self.mutex must be held.
+func (self *TimedRotateFile) startFileLocked() error {
+	size, err := writeHeader(self.file, self.header)
+	self.size = size
+	self.lastWrite = time.Now()
+	if fi, serr := self.file.Stat(); serr == nil {
+		self.lastWrite = fi.ModTime()
 	}
+	return err
+}
 
-	date := fileInfo.ModTime().Format("2006-01-02")
+// rotateLocked moves the file to a backup named after its modification
+// time and starts a new file. self.mutex must be held.
+func (self *TimedRotateFile) rotateLocked() (err error) {
+	self.hooks.failed(self.buffer.flush(self.file))
+	now := time.Now()
+	if self.symlink {
+		return self.rotateLinkedLocked(now)
+	}
+	// the modification time is of the flush above, maybe in the next period
+	date := self.lastWrite.Format(self.layout)
 	newPath := fmt.Sprintf("%s-%s", self.fileName, date)
 	for i := 1; true; i++ {
-		if _, err = os.Stat(newPath); err != nil {
-			if os.IsNotExist(err) {
-				err = os.Rename(self.fileName, newPath)
-				break
-			} else {
+		ok, err := exists(newPath)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			ok, err = exists(newPath + compressSuffix)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			if err = os.Rename(self.fileName, newPath); err != nil {
 				return err
 			}
+			break
 		}
 		newPath = fmt.Sprintf("%s-%s-%d", self.fileName, date, i)
 	}
 	self.file.Sync()
 	self.file.Close()
 
-	self.file, err = os.OpenFile(self.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	self.file, err = openFile(self.fileName, self.fileMode)
 	if err != nil {
 		return err
 	}
+	self.hooks.failed(self.startFileLocked())
 	self.setRotateTime(now)
+	finishBackup(newPath, self.fileName, self.compress, &self.compressing, &self.hooks)
 	self.prune()
 	return
 }
 
-// delete expired files
-func (self *TimedRotateFile) prune() {
-	dir := path.Dir(self.fileName)
-	// sorted fs
-	fs, _ := os.ReadDir(dir)
-	files := make([]string, 0, len(fs))
-	for _, f := range fs {
-		if f.IsDir() {
-			continue
-		}
-		if self.filePattern.MatchString(f.Name()) {
-			files = append(files, f.Name())
-		}
+// rotateLinkedLocked starts a new linked file; the previous one becomes
+// a backup. self.mutex must be held.
+func (self *TimedRotateFile) rotateLinkedLocked(now time.Time) error {
+	file, active, err := createLinked(self.fileName, linkedLayout(self.layout), self.fileMode)
+	if err != nil {
+		return err
 	}
+	_ = self.file.Sync()
+	_ = self.file.Close()
+	oldPath := self.active
+	self.file, self.active = file, active
+	self.hooks.failed(self.startFileLocked())
+	self.setRotateTime(now)
+	finishBackup(oldPath, self.active, self.compress, &self.compressing, &self.hooks)
+	self.prune()
+	return nil
+}
 
-	if len(files) > self.backupCount {
-		files = files[:len(files)-self.backupCount]
-		for _, f := range files {
-			err := os.Remove(f)
-			fmt.Println("delete", err)
+// delete expired files, the oldest files beyond backupCount and the
+// oldest files over the size budget. self.mutex must be held.
+func (self *TimedRotateFile) prune() {
+	backups := listBackups(path.Dir(self.fileName), self.filePattern)
+	backups = without(backups, self.active)
+	backups = removeExpired(backups, self.maxAge, &self.hooks)
+	if self.backupCount > 0 && len(backups) > self.backupCount {
+		for _, b := range backups[:len(backups)-self.backupCount] {
+			b.remove(&self.hooks)
 		}
+		backups = backups[len(backups)-self.backupCount:]
+	}
+	if self.maxTotal > 0 {
+		removeOverBudget(backups, self.size, self.maxTotal, &self.hooks)
 	}
 }
@@ -0,0 +1,44 @@
+package grlog
+
+import (
+	"strconv"
+	"time"
+)
+
+// Time layouts for Logger.SetTimeLayout. Besides these, any layout
+// accepted by time.Time.Format may be used, for example
+// "2006-01-02 15:04:05.000000000" for nanosecond precision.
+const (
+	TimeRFC3339     = time.RFC3339
+	TimeRFC3339Nano = time.RFC3339Nano
+	TimeUnix        = "unix"      // seconds since the Unix epoch: 1232674403
+	TimeUnixMilli   = "unixmilli" // milliseconds since the Unix epoch: 1232674403123
+	TimeUnixMicro   = "unixmicro" // microseconds since the Unix epoch
+	TimeUnixNano    = "unixnano"  // nanoseconds since the Unix epoch
+)
+
+// isUnixLayout reports whether layout writes the time as a number.
+func isUnixLayout(layout string) bool {
+	switch layout {
+	case TimeUnix, TimeUnixMilli, TimeUnixMicro, TimeUnixNano:
+		return true
+	}
+	return false
+}
+
+// appendTime writes t to buf in layout, which may be one of the Unix
+// epoch layouts.
+func appendTime(buf *[]byte, t time.Time, layout string) {
+	switch layout {
+	case TimeUnix:
+		*buf = strconv.AppendInt(*buf, t.Unix(), 10)
+	case TimeUnixMilli:
+		*buf = strconv.AppendInt(*buf, t.UnixMilli(), 10)
+	case TimeUnixMicro:
+		*buf = strconv.AppendInt(*buf, t.UnixMicro(), 10)
+	case TimeUnixNano:
+		*buf = strconv.AppendInt(*buf, t.UnixNano(), 10)
+	default:
+		*buf = t.AppendFormat(*buf, layout)
+	}
+}